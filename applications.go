@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultConcurrency is the number of applications deployed at the same time
+const DefaultConcurrency = 2
+
+// Application is one of the applications deployed by the plugin, empty fields inherit the plugin settings
+type Application struct {
+	ID          string `json:"id"`
+	Source      string `json:"source"`
+	PublisherID string `json:"publisher_id"`
+	// Package is a prebuilt .zip or .crx uploaded instead of the content of Source
+	Package string `json:"package"`
+	// Credentials used instead of the plugin ones, a refresh token or a service account key replace the authentication mode
+	ClientID          string `json:"client_id"`
+	ClientSecret      string `json:"client_secret"`
+	RefreshToken      string `json:"refresh_token"`
+	ServiceAccountKey string `json:"service_account_key"`
+}
+
+// ParseApplications decode a JSON list of applications, and applications given as ID=SOURCE
+func ParseApplications(list string, items []string) ([]Application, error) {
+	var applications []Application
+	if strings.TrimSpace(list) != "" {
+		if err := json.Unmarshal([]byte(list), &applications); err != nil {
+			return nil, fmt.Errorf("unable to decode applications: %v", err)
+		}
+	}
+
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid application %q, expected ID=SOURCE", item)
+		}
+		applications = append(applications, Application{ID: parts[0], Source: parts[1]})
+	}
+
+	seen := map[string]bool{}
+	for _, application := range applications {
+		if application.ID == "" {
+			return nil, fmt.Errorf("application ID is required")
+		}
+		if seen[application.ID] {
+			return nil, fmt.Errorf("application %s is listed more than once", application.ID)
+		}
+		seen[application.ID] = true
+	}
+
+	return applications, nil
+}
+
+// plugin return the plugin deploying only this application
+func (a Application) plugin(p Plugin) Plugin {
+	p.ApplicationID = a.ID
+	p.Applications = nil
+	// The injected client manage a single application, each application create its own client
+	p.Client = nil
+
+	if a.Source != "" {
+		// The source of the application has precedence on the package given to the plugin
+		p.Config.Source = a.Source
+		p.Config.Package = ""
+	}
+	if a.Package != "" {
+		p.Config.Package = a.Package
+	}
+	if a.PublisherID != "" {
+		p.API.PublisherID = a.PublisherID
+	}
+	if p.Config.Output != "" {
+		// Output is the directory receiving the package of each application
+		p.Config.Output = filepath.Join(p.Config.Output, a.ID+".zip")
+	}
+
+	auth := &p.Authentication
+	switch {
+	case a.ServiceAccountKey != "":
+		auth.ClientID, auth.ClientSecret, auth.RefreshToken = "", "", ""
+		auth.WorkloadIdentity = WorkloadIdentity{}
+		auth.ServiceAccountKey = a.ServiceAccountKey
+	case a.RefreshToken != "":
+		auth.ServiceAccountKey = ""
+		auth.WorkloadIdentity = WorkloadIdentity{}
+		auth.RefreshToken = a.RefreshToken
+	}
+	if a.ClientID != "" {
+		auth.ClientID = a.ClientID
+	}
+	if a.ClientSecret != "" {
+		auth.ClientSecret = a.ClientSecret
+	}
+
+	return p
+}
+
+// ApplicationError is the failure of the deploy of one application
+type ApplicationError struct {
+	ID  string
+	Err error
+}
+
+// ApplicationsError is returned when the deploy of at least one application failed
+type ApplicationsError struct {
+	Total  int
+	Errors []ApplicationError
+}
+
+func (e ApplicationsError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %v", err.ID, err.Err))
+	}
+
+	return fmt.Sprintf("%d of %d applications not deployed: %s", len(e.Errors), e.Total, strings.Join(messages, "; "))
+}
+
+// exitCodeSeverity order exit codes from the least to the most severe
+var exitCodeSeverity = []int{ExitCodePendingReview, ExitCodeRejected, ExitCodeUnauthorized, ExitCodeError}
+
+// exitCode return the most severe exit code among the failed applications
+func (e ApplicationsError) exitCode() int {
+	severity := -1
+	for _, err := range e.Errors {
+		code := exitCode(err.Err)
+		for i, c := range exitCodeSeverity {
+			if c == code && i > severity {
+				severity = i
+			}
+		}
+	}
+
+	if severity < 0 {
+		return ExitCodeError
+	}
+
+	return exitCodeSeverity[severity]
+}
+
+// execApplications deploy every application, at most Config.Concurrency at the same time, then log a summary
+func (p Plugin) execApplications(ctx context.Context) error {
+	if p.ApplicationID != "" {
+		return fmt.Errorf("application and applications can not be used together")
+	}
+
+	concurrency := p.Config.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	errs := make([]error, len(p.Applications))
+	checksums := make([]string, len(p.Applications))
+	names := make([]string, len(p.Applications))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, application := range p.Applications {
+		wg.Add(1)
+		go func(i int, application Application) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			logrus.WithField("application", application.ID).Infoln("deploying application")
+			plugin := application.plugin(p)
+			names[i] = plugin.packageName()
+			checksums[i], errs[i] = plugin.deploy(ctx)
+		}(i, application)
+	}
+	wg.Wait()
+
+	result := ApplicationsError{Total: len(p.Applications)}
+	var generated []packageChecksum
+	for i, application := range p.Applications {
+		entry := logrus.WithField("application", application.ID)
+		if checksums[i] != "" {
+			entry = entry.WithField("sha256", checksums[i])
+			generated = append(generated, packageChecksum{names[i], checksums[i]})
+		}
+
+		switch err := errs[i]; {
+		case err == nil:
+			entry.Infoln("application deployed")
+		case exitCode(err) == ExitCodePendingReview:
+			entry.WithError(err).Warningln("application pending review")
+		default:
+			entry.WithError(err).Errorln("application not deployed")
+		}
+
+		if errs[i] != nil {
+			result.Errors = append(result.Errors, ApplicationError{application.ID, errs[i]})
+		}
+	}
+
+	if len(generated) > 0 && p.Config.ChecksumFile != "" {
+		if err := writeChecksumFile(p.Config.ChecksumFile, generated); err != nil {
+			return err
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return result
+	}
+
+	return nil
+}
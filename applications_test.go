@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestApplicationPlugin(t *testing.T) {
+	base := Plugin{
+		Config: Config{Source: "src", Package: "extension.crx", Output: "dist"},
+	}
+
+	tests := []struct {
+		name        string
+		application Application
+		source      string
+		pkg         string
+	}{
+		{
+			name:        "inherit the package",
+			application: Application{ID: "app1"},
+			source:      "src",
+			pkg:         "extension.crx",
+		},
+		{
+			name:        "source replace the package",
+			application: Application{ID: "app1", Source: "app1"},
+			source:      "app1",
+		},
+		{
+			name:        "own package",
+			application: Application{ID: "app1", Source: "app1", Package: "app1.zip"},
+			source:      "app1",
+			pkg:         "app1.zip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.application.plugin(base)
+
+			if p.Config.Source != tt.source || p.Config.Package != tt.pkg {
+				t.Errorf("expected source %q and package %q, got %q and %q", tt.source, tt.pkg, p.Config.Source, p.Config.Package)
+			}
+			if output := filepath.Join("dist", "app1.zip"); p.Config.Output != output {
+				t.Errorf("expected output %s, got %s", output, p.Config.Output)
+			}
+			if p.ApplicationID != "app1" || p.Applications != nil {
+				t.Errorf("expected a plugin deploying only app1, got %q and %d applications", p.ApplicationID, len(p.Applications))
+			}
+		})
+	}
+}
+
+func TestParseApplications(t *testing.T) {
+	applications, err := ParseApplications(`[{"id": "app1", "package": "app1.crx"}]`, []string{"app2=src2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applications) != 2 || applications[0].Package != "app1.crx" || applications[1].Source != "src2" {
+		t.Errorf("unexpected applications %+v", applications)
+	}
+
+	for _, items := range [][]string{{"app1"}, {"=src"}, {"app1=src", "app1=other"}} {
+		if _, err := ParseApplications("", items); err == nil {
+			t.Errorf("expected an error for %q", items)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+// OAuth scopes used to access Chrome Webstore
+const (
+	ChromeWebstoreScope         = "https://www.googleapis.com/auth/chromewebstore"
+	ChromeWebstoreReadOnlyScope = "https://www.googleapis.com/auth/chromewebstore.readonly"
+)
+
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// Authentication modes, chosen from the credentials configured
+const (
+	AuthModeRefreshToken      = "refresh token"
+	AuthModeServiceAccountKey = "service account key"
+	AuthModeOIDCToken         = "OIDC token"
+)
+
+// TokenSource return a token source for the credentials configured, the authentication
+// mode is chosen from the settings present
+func (auth Authentication) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	modes := auth.modes()
+	if len(modes) > 1 {
+		return nil, fmt.Errorf("%s are configured, only one is allowed", strings.Join(modes, " and "))
+	}
+
+	switch {
+	case auth.ServiceAccountKey != "":
+		return auth.serviceAccountTokenSource(ctx)
+	case auth.WorkloadIdentity.Enabled():
+		return newFederatedTokenSource(ctx, auth.WorkloadIdentity, auth.scope())
+	case auth.RefreshToken != "":
+		return auth.refreshTokenSource(ctx), nil
+	}
+
+	return nil, fmt.Errorf("no credentials configured, a refresh token, a service account key or an OIDC token is required")
+}
+
+// modes return the authentication modes configured, only one is allowed
+func (auth Authentication) modes() []string {
+	var modes []string
+	if auth.RefreshToken != "" {
+		modes = append(modes, AuthModeRefreshToken)
+	}
+	if auth.ServiceAccountKey != "" {
+		modes = append(modes, AuthModeServiceAccountKey)
+	}
+	if auth.WorkloadIdentity.Enabled() {
+		modes = append(modes, AuthModeOIDCToken)
+	}
+
+	return modes
+}
+
+// Mode return the authentication mode configured, empty when none or several are configured
+func (auth Authentication) Mode() string {
+	if modes := auth.modes(); len(modes) == 1 {
+		return modes[0]
+	}
+
+	return ""
+}
+
+func (auth Authentication) scope() string {
+	if auth.Scope == "" {
+		return ChromeWebstoreScope
+	}
+
+	return auth.Scope
+}
+
+func (auth Authentication) tokenURL() string {
+	if auth.TokenURL == "" {
+		return DefaultTokenURL
+	}
+
+	return auth.TokenURL
+}
+
+// refreshTokenSource return a token source refreshing the access token with the refresh token,
+// restricted to Scope when set
+func (auth Authentication) refreshTokenSource(ctx context.Context) oauth2.TokenSource {
+	if auth.Scope != "" {
+		return oauth2.ReuseTokenSource(nil, scopedRefreshTokenSource{ctx, auth})
+	}
+
+	cfg := oauth2.Config{
+		ClientID:     auth.ClientID,
+		ClientSecret: auth.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  DefaultAuthURL,
+			TokenURL: auth.tokenURL(),
+		},
+		Scopes: []string{
+			auth.scope(),
+		},
+	}
+
+	return cfg.TokenSource(ctx, &oauth2.Token{
+		RefreshToken: auth.RefreshToken,
+	})
+}
+
+// scopedRefreshTokenSource refresh the access token sending the requested scope, so the token can be
+// restricted to a subset of the scopes granted; the oauth2 package does not send it on refresh
+type scopedRefreshTokenSource struct {
+	ctx  context.Context
+	auth Authentication
+}
+
+// Token refresh the access token, it fails when the refresh token has not been granted the requested scope
+func (ts scopedRefreshTokenSource) Token() (*oauth2.Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", ts.auth.RefreshToken)
+	form.Set("client_id", ts.auth.ClientID)
+	form.Set("client_secret", ts.auth.ClientSecret)
+	form.Set("scope", ts.auth.Scope)
+
+	req, err := http.NewRequest("POST", ts.auth.tokenURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := contextClient(ts.ctx).Do(req.WithContext(ts.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh access token: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := decodeResponse(res, &response); err != nil {
+		if oauthError(err) == "invalid_scope" {
+			return nil, fmt.Errorf("refresh token has not been granted the scope %s, generate a new one with the auth login command", ts.auth.Scope)
+		}
+		return nil, fmt.Errorf("unable to refresh access token: %v", err)
+	}
+	if response.AccessToken == "" {
+		return nil, fmt.Errorf("unable to refresh access token: server response missing access_token")
+	}
+
+	tkn := &oauth2.Token{
+		AccessToken: response.AccessToken,
+		TokenType:   response.TokenType,
+	}
+	if response.ExpiresIn > 0 {
+		tkn.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+
+	return tkn, nil
+}
+
+// oauthError return the error code of an OAuth error response, empty when err is not one
+func oauthError(err error) string {
+	apiErr, ok := err.(APIError)
+	if !ok {
+		return ""
+	}
+
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(apiErr.Body), &response); err != nil {
+		return ""
+	}
+
+	return response.Error
+}
+
+// serviceAccountTokenSource sign JWT assertions with the service account key
+func (auth Authentication) serviceAccountTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	content := []byte(auth.ServiceAccountKey)
+	if !strings.HasPrefix(strings.TrimSpace(auth.ServiceAccountKey), "{") {
+		var err error
+		if content, err = ioutil.ReadFile(auth.ServiceAccountKey); err != nil {
+			return nil, fmt.Errorf("unable to read service account key: %v", err)
+		}
+	}
+
+	var key serviceAccountKey
+	if err := json.Unmarshal(content, &key); err != nil {
+		return nil, fmt.Errorf("unable to decode service account key: %v", err)
+	}
+
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("unsupported credentials type %q, a service account key is required", key.Type)
+	}
+
+	cfg := jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		Scopes: []string{
+			auth.scope(),
+		},
+		TokenURL: auth.tokenURL(),
+	}
+	if auth.TokenURL == "" && key.TokenURI != "" {
+		cfg.TokenURL = key.TokenURI
+	}
+
+	return cfg.TokenSource(ctx), nil
+}
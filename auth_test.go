@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mavimo/drone-chromewebstore/fakestore"
+)
+
+// newTokenServer start a token endpoint recording the scope of each refresh,
+// refresh requesting one of the refused scopes are answered with invalid_scope
+func newTokenServer(refused ...string) (*httptest.Server, *[]string) {
+	var scopes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") == "" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+
+		scope := r.PostForm.Get("scope")
+		scopes = append(scopes, scope)
+		for _, s := range refused {
+			if scope == s {
+				http.Error(w, `{"error":"invalid_scope"}`, http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+
+	return server, &scopes
+}
+
+func TestRefreshTokenScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		refused []string
+		// requested are the scopes sent by each refresh request
+		requested []string
+		err       string
+	}{
+		{
+			name:      "default scope",
+			requested: []string{""},
+		},
+		{
+			name:      "read only scope",
+			scope:     ChromeWebstoreReadOnlyScope,
+			requested: []string{ChromeWebstoreReadOnlyScope},
+		},
+		{
+			name:      "scope not granted",
+			scope:     ChromeWebstoreReadOnlyScope,
+			refused:   []string{ChromeWebstoreReadOnlyScope},
+			requested: []string{ChromeWebstoreReadOnlyScope},
+			err:       "refresh token has not been granted the scope " + ChromeWebstoreReadOnlyScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, scopes := newTokenServer(tt.refused...)
+			defer server.Close()
+
+			auth := Authentication{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				RefreshToken: "refresh",
+				TokenURL:     server.URL,
+				Scope:        tt.scope,
+			}
+
+			ts, err := auth.TokenSource(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tkn, err := ts.Token()
+			switch {
+			case tt.err != "":
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tkn.AccessToken != "token":
+				t.Errorf("expected access token %q, got %q", "token", tkn.AccessToken)
+			}
+
+			if strings.Join(*scopes, ",") != strings.Join(tt.requested, ",") {
+				t.Errorf("expected scopes %q, got %q", tt.requested, *scopes)
+			}
+		})
+	}
+}
+
+func TestDescribeTokenError(t *testing.T) {
+	invalidGrant := errors.New(`unexpected status 400 Bad Request: {"error":"invalid_grant"}`)
+	invalidClient := errors.New(`unexpected status 401 Unauthorized: {"error":"invalid_client"}`)
+
+	tests := []struct {
+		mode   string
+		err    error
+		prefix string
+	}{
+		{AuthModeRefreshToken, invalidGrant, "refresh token has been revoked"},
+		{AuthModeRefreshToken, invalidClient, "client ID or client secret are wrong"},
+		{AuthModeServiceAccountKey, invalidGrant, "service account key has been deleted"},
+		{AuthModeServiceAccountKey, invalidClient, "unable to get an access token"},
+		{AuthModeOIDCToken, invalidGrant, "OIDC token is expired"},
+		{"", invalidGrant, "unable to get an access token"},
+	}
+
+	for _, tt := range tests {
+		if message := describeTokenError(tt.mode, tt.err); !strings.HasPrefix(message, tt.prefix) {
+			t.Errorf("%s: expected message starting with %q, got %q", tt.mode, tt.prefix, message)
+		}
+	}
+}
+
+// newServiceAccountKey return a service account JSON key with a generated RSA key
+func newServiceAccountKey(t *testing.T, keyType, tokenURI string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	content, err := json.Marshal(serviceAccountKey{
+		Type:         keyType,
+		ClientEmail:  "deploy@project.iam.gserviceaccount.com",
+		PrivateKey:   string(privateKey),
+		PrivateKeyID: "key1",
+		TokenURI:     tokenURI,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestServiceAccountTokenSource(t *testing.T) {
+	store := fakestore.New()
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ParseForm() == nil && r.PostForm.Get("grant_type") == "urn:ietf:params:oauth:grant-type:jwt-bearer" && r.PostForm.Get("assertion") != "" {
+			paths = append(paths, r.URL.Path)
+		}
+		store.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	key := newServiceAccountKey(t, "service_account", server.URL+"/token")
+	file, err := ioutil.TempFile("", "drone-chromewebstore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(key); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	tests := []struct {
+		name     string
+		key      string
+		tokenURL string
+		// path is the token endpoint expected to receive the assertion, empty when an error is expected
+		path string
+		err  string
+	}{
+		{
+			name: "inline content",
+			key:  "\n  " + key,
+			path: "/token",
+		},
+		{
+			name: "path",
+			key:  file.Name(),
+			path: "/token",
+		},
+		{
+			name:     "token URL has precedence on token_uri",
+			key:      key,
+			tokenURL: server.URL + "/o/oauth2/token",
+			path:     "/o/oauth2/token",
+		},
+		{
+			name: "not a service account",
+			key:  newServiceAccountKey(t, "authorized_user", server.URL+"/token"),
+			err:  `unsupported credentials type "authorized_user"`,
+		},
+		{
+			name: "missing file",
+			key:  file.Name() + ".missing",
+			err:  "unable to read service account key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths = nil
+			auth := Authentication{ServiceAccountKey: tt.key, TokenURL: tt.tokenURL}
+
+			ts, err := auth.TokenSource(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tkn, err := ts.Token()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tkn.AccessToken != fakestore.AccessToken {
+				t.Errorf("expected access token %q, got %q", fakestore.AccessToken, tkn.AccessToken)
+			}
+			if strings.Join(paths, ",") != tt.path {
+				t.Errorf("expected assertion sent to %s, got %q", tt.path, paths)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+var cancelCommand = cli.Command{
+	Name:   "cancel",
+	Usage:  "Cancel the submission of the application pending review",
+	Action: cancelSubmission,
+	Flags:  pluginFlags,
+}
+
+func cancelSubmission(c *cli.Context) error {
+	plugin := newPlugin(c)
+
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+
+	client, err := NewChromeWebstoreClient(ctx, plugin.ApplicationID, plugin.API, plugin.Authentication)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to create a chrome webstore client: %v", err), ExitCodeError)
+	}
+
+	state, err := client.CancelSubmission(ctx)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to cancel submission: %v", err), ExitCodeError)
+	}
+
+	fmt.Printf("Submission of application %s cancelled, application state is %s\n", plugin.ApplicationID, state)
+
+	return nil
+}
@@ -1,125 +1,397 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 )
 
+// Chrome Webstore API versions supported by the client
+const (
+	APIVersion1 = "v1.1"
+	APIVersion2 = "v2"
+)
+
+// Default endpoints used to reach Google services
+const (
+	DefaultAPIBaseURL   = "https://www.googleapis.com"
+	DefaultAPIV2BaseURL = "https://chromewebstore.googleapis.com"
+	DefaultTokenURL     = "https://accounts.google.com/o/oauth2/token"
+)
+
+// Default polling of uploads still processed by Chrome Webstore
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultPollTimeout  = 5 * time.Minute
+)
+
+// WebstoreAPI describe the operations of Chrome Webstore used to deploy an application
+type WebstoreAPI interface {
+	UploadNewVersion(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error)
+	GetInfo(ctx context.Context, projection string) (Item, error)
+	WaitForUpload(ctx context.Context, interval, timeout time.Duration) (Item, error)
+	PublishVersion(ctx context.Context, target string, deployPercentage *int) (PublishResult, error)
+}
+
+var _ WebstoreAPI = ChromeWebstoreClient{}
+
 // ChromeWebstoreClient create an http client to interact with Crome Webstore API
 type ChromeWebstoreClient struct {
 	*http.Client
 	ApplicationID string
+	PublisherID   string
+	APIVersion    string
+	BaseURL       string
+	// UploadMode is UploadModeResumable to send packages in chunks, or UploadModeSimple
+	UploadMode      string
+	UploadChunkSize int64
+	// Retry policy used to resume interrupted uploads
+	Retry RetryPolicy
 }
 
-// NewChromeWebstoreClient generate a new client to interact with Chrome Webstore API
-func NewChromeWebstoreClient(applicationID string, auth Authentication) (ChromeWebstoreClient, error) {
-	ctx := context.Background()
-	cfg := oauth2.Config{
-		ClientID:     auth.ClientID,
-		ClientSecret: auth.ClientSecret,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
-			TokenURL: "https://accounts.google.com/o/oauth2/token",
-		},
-		RedirectURL: "urn:ietf:wg:oauth:2.0:oob",
-		Scopes: []string{
-			"https://www.googleapis.com/auth/chromewebstore",
-		},
+// NewChromeWebstoreClient generate a new client to interact with Chrome Webstore API,
+// ctx is used to get the access token and must be kept alive while the client is used
+func NewChromeWebstoreClient(ctx context.Context, applicationID string, api API, auth Authentication) (ChromeWebstoreClient, error) {
+	version := api.Version
+	if version == "" {
+		version = APIVersion1
 	}
 
-	ts := cfg.TokenSource(ctx, &oauth2.Token{
-		RefreshToken: auth.RefreshToken,
+	baseURL := api.BaseURL
+	switch version {
+	case APIVersion1:
+		if baseURL == "" {
+			baseURL = DefaultAPIBaseURL
+		}
+	case APIVersion2:
+		if baseURL == "" {
+			baseURL = DefaultAPIV2BaseURL
+		}
+		if api.PublisherID == "" {
+			return ChromeWebstoreClient{}, fmt.Errorf("publisher ID is required by API %s", APIVersion2)
+		}
+	default:
+		return ChromeWebstoreClient{}, fmt.Errorf("unsupported API version %s", version)
+	}
+
+	uploadMode := api.UploadMode
+	if uploadMode == "" {
+		uploadMode = UploadModeSimple
+	}
+	if uploadMode != UploadModeResumable && uploadMode != UploadModeSimple {
+		return ChromeWebstoreClient{}, fmt.Errorf("unsupported upload mode %s", uploadMode)
+	}
+
+	chunkSize := api.UploadChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	if chunkSize < 0 || chunkSize%uploadChunkGranularity != 0 {
+		return ChromeWebstoreClient{}, fmt.Errorf("upload chunk size should be a multiple of %d bytes, got %d", uploadChunkGranularity, chunkSize)
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{
+		// Token refresh can always be retried, it does not change any state
+		Transport: &RetryTransport{Policy: api.Retry, Idempotent: true},
+		Timeout:   auth.Timeout,
 	})
 
-	tkn, err := ts.Token()
+	ts, err := auth.TokenSource(ctx)
 	if err != nil {
-		return ChromeWebstoreClient{}, fmt.Errorf("unable to refresh token: %v", err)
+		return ChromeWebstoreClient{}, err
 	}
 
-	return ChromeWebstoreClient{cfg.Client(ctx, tkn), applicationID}, nil
+	// The first token is got within the token phase, later refreshes are limited by the HTTP client timeout
+	tokenCtx, cancel := withTimeout(ctx, auth.Timeout)
+	defer cancel()
+	initial, err := auth.TokenSource(tokenCtx)
+	if err != nil {
+		return ChromeWebstoreClient{}, err
+	}
+
+	tkn, err := initial.Token()
+	if err != nil {
+		err = fmt.Errorf("unable to refresh token: %v", err)
+		if tokenCtx.Err() != nil {
+			return ChromeWebstoreClient{}, phaseError(tokenCtx, "token", err)
+		}
+		return ChromeWebstoreClient{}, UnauthorizedError{err}
+	}
+
+	httpClient := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.ReuseTokenSource(tkn, ts),
+			Base:   &RetryTransport{Policy: api.Retry},
+		},
+	}
+
+	return ChromeWebstoreClient{
+		Client:          httpClient,
+		ApplicationID:   applicationID,
+		PublisherID:     api.PublisherID,
+		APIVersion:      version,
+		BaseURL:         strings.TrimSuffix(baseURL, "/"),
+		UploadMode:      uploadMode,
+		UploadChunkSize: chunkSize,
+		Retry:           api.Retry,
+	}, nil
 }
 
 // UploadNewVersion send a new version of application to Chrome Webstore
-func (client ChromeWebstoreClient) UploadNewVersion(buf *bytes.Buffer) error {
-	// Try to upload zip file
-	req, err := http.NewRequest("PUT", fmt.Sprintf("https://www.googleapis.com/upload/chromewebstore/v1.1/items/%s", client.ApplicationID), buf)
+func (client ChromeWebstoreClient) UploadNewVersion(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error) {
+	var result UploadResult
+	var err error
+	if client.APIVersion == APIVersion2 {
+		result, err = client.uploadV2(ctx, pkg)
+	} else {
+		result, err = client.uploadV1(ctx, pkg)
+	}
 	if err != nil {
-		return fmt.Errorf("unable to create upload request: %v", err)
+		return UploadResult{}, err
 	}
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("x-goog-api-version", "2")
 
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("unable to upload zip file: %v", err)
+	logrus.WithFields(logrus.Fields{
+		"id":          result.ID,
+		"uploadState": result.UploadState,
+	}).Infoln("application uploaded")
+
+	if err := result.Err(); err != nil {
+		return result, fmt.Errorf("upload of application %s refused: %v", client.ApplicationID, err)
 	}
-	defer res.Body.Close()
 
-	message, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("unable to get response when upload application: %v", err)
+	return result, nil
+}
+
+// GetInfo get information on an application froom Chrome Webstore, projection should be DRAFT or PUBLISHED
+func (client ChromeWebstoreClient) GetInfo(ctx context.Context, projection string) (Item, error) {
+	if projection != ProjectionDraft && projection != ProjectionPublished {
+		return Item{}, fmt.Errorf("unsupported projection %s", projection)
 	}
 
-	logrus.Infoln(string(message))
+	if client.APIVersion == APIVersion2 {
+		return client.getInfoV2(ctx, projection)
+	}
 
-	return nil
+	return client.getInfoV1(ctx, projection)
 }
 
-// GetInfo get information on an application froom Chrome Webstore
-func (client ChromeWebstoreClient) GetInfo() error {
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://www.googleapis.com/chromewebstore/v1.1/items/%s?projection=DRAFT", client.ApplicationID), nil)
-	if err != nil {
-		return fmt.Errorf("unable to create info request: %v", err)
+// WaitForUpload poll Chrome Webstore until the upload processing is completed or timeout expires,
+// a zero interval or timeout use DefaultPollInterval and DefaultPollTimeout
+func (client ChromeWebstoreClient) WaitForUpload(ctx context.Context, interval, timeout time.Duration) (Item, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	if timeout <= 0 {
+		timeout = DefaultPollTimeout
 	}
-	req.Header.Set("x-goog-api-version", "2")
 
-	res, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("unable to fetch infos for application: %v", err)
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		item, err := client.GetInfo(ctx, ProjectionDraft)
+		if err != nil {
+			return Item{}, err
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"id":          item.ID,
+			"uploadState": item.UploadState,
+		}).Infoln("checking upload status")
+
+		if item.UploadState != UploadStateInProgress {
+			if item.UploadState != UploadStateSuccess {
+				return item, fmt.Errorf("upload state is %s: %s", item.UploadState, formatItemErrors(item.ItemError))
+			}
+
+			return item, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return item, fmt.Errorf("upload still in progress after %s", timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return item, ctx.Err()
+		case <-ticker.C:
+		}
 	}
-	defer res.Body.Close()
+}
 
-	message, err := ioutil.ReadAll(res.Body)
+// PublishVersion publish the last uploaded version of an application in Chrome Webstore
+// A nil deployPercentage publish the version to all users.
+func (client ChromeWebstoreClient) PublishVersion(ctx context.Context, target string, deployPercentage *int) (PublishResult, error) {
+	if deployPercentage != nil {
+		if err := validateDeployPercentage(*deployPercentage); err != nil {
+			return PublishResult{}, err
+		}
+	}
+
+	var result PublishResult
+	var err error
+	if client.APIVersion == APIVersion2 {
+		result, err = client.publishV2(ctx, target, deployPercentage)
+	} else {
+		result, err = client.publishV1(ctx, target, deployPercentage)
+	}
 	if err != nil {
-		return fmt.Errorf("unable to get response when get info for application: %v", err)
+		return PublishResult{}, err
 	}
 
-	logrus.Infoln(string(message))
+	fields := logrus.Fields{
+		"id":           result.ItemID,
+		"status":       result.Status,
+		"statusDetail": result.StatusDetail,
+	}
+	if result.DeployPercentage != nil {
+		fields["deployPercentage"] = *result.DeployPercentage
+	} else if deployPercentage != nil {
+		// The store did not confirm the percentage applied
+		fields["requestedDeployPercentage"] = *deployPercentage
+	}
+	logrus.WithFields(fields).Infoln("application publish requested")
 
-	return nil
+	if result.Outcome() != PublishOutcomePublished {
+		return result, PublishError{result}
+	}
+
+	return result, nil
 }
 
-// PublishVersion get information on an application froom Chrome Webstore
-func (client ChromeWebstoreClient) PublishVersion(target string) error {
-	if target != "default" && target != "trustedTesters" {
-		return fmt.Errorf("unable to publish application %s", client.ApplicationID)
+// SetDeployPercentage change the percentage of users receiving the published version,
+// it return the effective percentage reported by the store, nil when the store does not report it (API v1.1)
+// or when it can not be read back once changed (API v2)
+func (client ChromeWebstoreClient) SetDeployPercentage(ctx context.Context, percentage int) (*int, error) {
+	if err := validateDeployPercentage(percentage); err != nil {
+		return nil, err
+	}
+
+	var effective *int
+	if client.APIVersion == APIVersion2 {
+		var err error
+		if effective, err = client.setDeployPercentageV2(ctx, percentage); err != nil {
+			return nil, err
+		}
+	} else {
+		result, err := client.publishV1(ctx, "default", &percentage)
+		if err != nil {
+			return nil, err
+		}
+		if result.Outcome() != PublishOutcomePublished {
+			return nil, PublishError{result}
+		}
+	}
+
+	if effective == nil {
+		logrus.WithFields(logrus.Fields{
+			"id":                        client.ApplicationID,
+			"requestedDeployPercentage": percentage,
+		}).Infoln("deploy percentage requested, not confirmed by the store")
+
+		return nil, nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id":               client.ApplicationID,
+		"deployPercentage": *effective,
+	}).Infoln("deploy percentage updated")
+
+	return effective, nil
+}
+
+// CancelSubmission cancel the submission of an application pending review,
+// it return the state of the application once the submission is cancelled
+func (client ChromeWebstoreClient) CancelSubmission(ctx context.Context) (string, error) {
+	if client.APIVersion != APIVersion2 {
+		return "", fmt.Errorf("cancel submission is not supported by API %s", client.APIVersion)
+	}
+
+	state, err := client.cancelSubmissionV2(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://www.googleapis.com/chromewebstore/v1.1/items/%s/publish", client.ApplicationID), nil)
+	logrus.WithFields(logrus.Fields{
+		"id":    client.ApplicationID,
+		"state": state,
+	}).Infoln("submission cancelled")
+
+	return state, nil
+}
+
+// newRequest build a request to Chrome Webstore API with the query parameters encoded in the URL,
+// a nil query keep the query of the endpoint
+func (client ChromeWebstoreClient) newRequest(ctx context.Context, method, endpoint string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return fmt.Errorf("unable to create publish request: %v", err)
+		return nil, err
+	}
+	if query != nil {
+		u.RawQuery = query.Encode()
 	}
-	req.Header.Set("x-goog-api-version", "2")
-	req.URL.Query().Add("publishTarget", target)
 
-	res, err := client.Do(req)
+	req, err := http.NewRequest(method, u.String(), body)
 	if err != nil {
-		return fmt.Errorf("unable to publish application: %v", err)
+		return nil, err
 	}
-	defer res.Body.Close()
+	req = req.WithContext(ctx)
+	if client.APIVersion != APIVersion2 {
+		req.Header.Set("x-goog-api-version", "2")
+	}
+
+	return req, nil
+}
+
+// APIError is returned when the API answer with a non 2xx status
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
 
+func (e APIError) Error() string {
+	return fmt.Sprintf("unexpected status %s: %s", e.Status, e.Body)
+}
+
+// Unauthorized indicate if the credentials have been refused
+func (e APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// UnauthorizedError is returned when the credentials are refused, by the token endpoint or by the store
+type UnauthorizedError struct {
+	Err error
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.Err.Error()
+}
+
+// decodeResponse read the response body and decode it in v, non 2xx responses are reported as error
+func decodeResponse(res *http.Response, v interface{}) error {
 	message, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("unable to get response when publish application: %v", err)
+		return err
 	}
 
-	logrus.Infoln(string(message))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return APIError{res.StatusCode, res.Status, strings.TrimSpace(string(message))}
+	}
+
+	if err := json.Unmarshal(message, v); err != nil {
+		return fmt.Errorf("unable to decode response %q: %v", string(message), err)
+	}
 
 	return nil
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordedRequest is the part of a request checked by the tests
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// newRecordingServer start a server answering body to every request, and recording them.
+// The caller is responsible to close the server.
+func newRecordingServer(body string) (*httptest.Server, *[]recordedRequest) {
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, recordedRequest{r.Method, r.URL.Path, r.URL.Query()})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	return server, &requests
+}
+
+func newTestClient(server *httptest.Server) ChromeWebstoreClient {
+	return ChromeWebstoreClient{
+		Client:        server.Client(),
+		ApplicationID: "app1",
+		APIVersion:    APIVersion1,
+		BaseURL:       server.URL,
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestPublishVersionV1Query(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           string
+		deployPercentage *int
+		query            url.Values
+	}{
+		{
+			name:   "default target",
+			target: "default",
+			query:  url.Values{"publishTarget": {"default"}},
+		},
+		{
+			name:   "trusted testers",
+			target: "trustedTesters",
+			query:  url.Values{"publishTarget": {"trustedTesters"}},
+		},
+		{
+			name:             "deploy percentage",
+			target:           "default",
+			deployPercentage: intPtr(25),
+			query:            url.Values{"publishTarget": {"default"}, "deployPercentage": {"25"}},
+		},
+		{
+			name:             "zero deploy percentage",
+			target:           "default",
+			deployPercentage: intPtr(0),
+			query:            url.Values{"publishTarget": {"default"}, "deployPercentage": {"0"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newRecordingServer(`{"kind":"chromewebstore#item","item_id":"app1","status":["OK"],"statusDetail":["OK"]}`)
+			defer server.Close()
+
+			if _, err := newTestClient(server).PublishVersion(context.Background(), tt.target, tt.deployPercentage); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.Method != "POST" || req.Path != "/chromewebstore/v1.1/items/app1/publish" {
+				t.Errorf("unexpected request %s %s", req.Method, req.Path)
+			}
+			if req.Query.Encode() != tt.query.Encode() {
+				t.Errorf("expected query %q, got %q", tt.query.Encode(), req.Query.Encode())
+			}
+		})
+	}
+}
+
+func TestPublishVersionV1InvalidTarget(t *testing.T) {
+	server, requests := newRecordingServer(`{}`)
+	defer server.Close()
+
+	if _, err := newTestClient(server).PublishVersion(context.Background(), "everyone", nil); err == nil {
+		t.Fatal("expected an error for an unsupported target")
+	}
+	if len(*requests) != 0 {
+		t.Errorf("expected no request, got %d", len(*requests))
+	}
+}
+
+func TestGetInfoV1Query(t *testing.T) {
+	for _, projection := range []string{ProjectionDraft, ProjectionPublished} {
+		t.Run(projection, func(t *testing.T) {
+			server, requests := newRecordingServer(`{"kind":"chromewebstore#item","id":"app1","uploadState":"SUCCESS"}`)
+			defer server.Close()
+
+			item, err := newTestClient(server).GetInfo(context.Background(), projection)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item.ID != "app1" || item.UploadState != UploadStateSuccess {
+				t.Errorf("unexpected item %+v", item)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.Method != "GET" || req.Path != "/chromewebstore/v1.1/items/app1" {
+				t.Errorf("unexpected request %s %s", req.Method, req.Path)
+			}
+			if got := req.Query.Encode(); got != "projection="+projection {
+				t.Errorf("expected projection %s, got query %q", projection, got)
+			}
+		})
+	}
+}
+
+func TestGetInfoInvalidProjection(t *testing.T) {
+	server, requests := newRecordingServer(`{}`)
+	defer server.Close()
+
+	if _, err := newTestClient(server).GetInfo(context.Background(), "LATEST"); err == nil {
+		t.Fatal("expected an error for an unsupported projection")
+	}
+	if len(*requests) != 0 {
+		t.Errorf("expected no request, got %d", len(*requests))
+	}
+}
+
+func TestNewChromeWebstoreClientTokenTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	auth := Authentication{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RefreshToken: "refresh",
+		TokenURL:     server.URL,
+		Timeout:      50 * time.Millisecond,
+	}
+
+	_, err := NewChromeWebstoreClient(context.Background(), "app1", API{BaseURL: server.URL}, auth)
+	if err == nil || !strings.HasPrefix(err.Error(), "token phase timed out") {
+		t.Fatalf("expected token phase timeout, got %v", err)
+	}
+}
+
+func TestDeployPercentageV2ReadBackFailure(t *testing.T) {
+	// The store accept the changes, but the status can not be read back
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":publish"):
+			w.Write([]byte(`{"name":"publishers/pub1/items/app1","itemId":"app1","state":"PUBLISHED"}`))
+		case strings.HasSuffix(r.URL.Path, ":setPublishedDeployPercentage"):
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, `{"error":{"status":"INTERNAL"}}`, http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	client.APIVersion = APIVersion2
+	client.PublisherID = "pub1"
+
+	result, err := client.PublishVersion(context.Background(), "default", intPtr(25))
+	if err != nil {
+		t.Fatalf("unexpected error on publish: %v", err)
+	}
+	if result.DeployPercentage != nil {
+		t.Errorf("expected no deploy percentage confirmed, got %d", *result.DeployPercentage)
+	}
+
+	effective, err := client.SetDeployPercentage(context.Background(), 50)
+	if err != nil {
+		t.Fatalf("unexpected error on deploy percentage: %v", err)
+	}
+	if effective != nil {
+		t.Errorf("expected no deploy percentage confirmed, got %d", *effective)
+	}
+}
+
+func TestNewChromeWebstoreClientDefaultUploadMode(t *testing.T) {
+	server, _ := newTokenServer()
+	defer server.Close()
+
+	auth := Authentication{ClientID: "client", ClientSecret: "secret", RefreshToken: "refresh", TokenURL: server.URL}
+	client, err := NewChromeWebstoreClient(context.Background(), "app1", API{BaseURL: server.URL}, auth)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.UploadMode != UploadModeSimple {
+		t.Errorf("expected upload mode %s by default, got %s", UploadModeSimple, client.UploadMode)
+	}
+}
+
+func TestStatesV2(t *testing.T) {
+	uploadStates := map[string]string{
+		"SUCCEEDED":   UploadStateSuccess,
+		"FAILED":      UploadStateFailure,
+		"IN_PROGRESS": UploadStateInProgress,
+		"":            UploadStateNotFound,
+	}
+	for state, expected := range uploadStates {
+		if got := uploadStateV2(state); got != expected {
+			t.Errorf("expected upload state %q for %q, got %q", expected, state, got)
+		}
+	}
+
+	publishStatuses := map[string]string{
+		"PUBLISHED":            "OK",
+		"PUBLISHED_TO_TESTERS": "OK",
+		"STAGED":               "OK",
+		"PENDING_REVIEW":       "ITEM_PENDING_REVIEW",
+		"REJECTED":             "ITEM_REJECTED",
+	}
+	for state, expected := range publishStatuses {
+		if got := publishStatusV2(state); got != expected {
+			t.Errorf("expected publish status %q for %q, got %q", expected, state, got)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+func (client ChromeWebstoreClient) uploadV1(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error) {
+	// Try to upload zip file
+	send := client.sendPackage
+	if client.UploadMode == UploadModeResumable {
+		send = client.sendPackageResumable
+	}
+
+	res, err := send(ctx, "PUT", fmt.Sprintf("%s/upload/chromewebstore/v1.1/items/%s", client.BaseURL, client.ApplicationID), "application/octet-stream", pkg)
+	if err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return UploadResult{}, apiErr
+		}
+		return UploadResult{}, fmt.Errorf("unable to upload zip file: %v", err)
+	}
+	defer res.Body.Close()
+
+	var result UploadResult
+	if err := decodeResponse(res, &result); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return UploadResult{}, apiErr
+		}
+		return UploadResult{}, fmt.Errorf("unable to get response when upload application: %v", err)
+	}
+
+	return result, nil
+}
+
+func (client ChromeWebstoreClient) getInfoV1(ctx context.Context, projection string) (Item, error) {
+	query := url.Values{}
+	query.Set("projection", projection)
+
+	req, err := client.newRequest(ctx, "GET", fmt.Sprintf("%s/chromewebstore/v1.1/items/%s", client.BaseURL, client.ApplicationID), query, nil)
+	if err != nil {
+		return Item{}, fmt.Errorf("unable to create info request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return Item{}, fmt.Errorf("unable to fetch infos for application: %v", err)
+	}
+	defer res.Body.Close()
+
+	var item Item
+	if err := decodeResponse(res, &item); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return Item{}, apiErr
+		}
+		return Item{}, fmt.Errorf("unable to get response when get info for application: %v", err)
+	}
+
+	return item, nil
+}
+
+func (client ChromeWebstoreClient) publishV1(ctx context.Context, target string, deployPercentage *int) (PublishResult, error) {
+	if target != "default" && target != "trustedTesters" {
+		return PublishResult{}, fmt.Errorf("unable to publish application %s", client.ApplicationID)
+	}
+
+	query := url.Values{}
+	query.Set("publishTarget", target)
+	if deployPercentage != nil {
+		query.Set("deployPercentage", strconv.Itoa(*deployPercentage))
+	}
+
+	req, err := client.newRequest(ctx, "POST", fmt.Sprintf("%s/chromewebstore/v1.1/items/%s/publish", client.BaseURL, client.ApplicationID), query, nil)
+	if err != nil {
+		return PublishResult{}, fmt.Errorf("unable to create publish request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return PublishResult{}, fmt.Errorf("unable to publish application: %v", err)
+	}
+	defer res.Body.Close()
+
+	var result PublishResult
+	if err := decodeResponse(res, &result); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return PublishResult{}, apiErr
+		}
+		return PublishResult{}, fmt.Errorf("unable to get response when publish application: %v", err)
+	}
+
+	// API v1.1 does not report the deploy percentage, so DeployPercentage is left unset
+	return result, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type uploadResponseV2 struct {
+	Name        string `json:"name"`
+	ItemID      string `json:"itemId"`
+	CrxVersion  string `json:"crxVersion"`
+	UploadState string `json:"uploadState"`
+}
+
+type distributionChannelV2 struct {
+	DeployPercentage int    `json:"deployPercentage"`
+	CrxVersion       string `json:"crxVersion"`
+}
+
+type itemRevisionStatusV2 struct {
+	State                string                  `json:"state"`
+	DistributionChannels []distributionChannelV2 `json:"distributionChannels"`
+}
+
+type fetchStatusResponseV2 struct {
+	Name                        string                `json:"name"`
+	ItemID                      string                `json:"itemId"`
+	PublishedItemRevisionStatus *itemRevisionStatusV2 `json:"publishedItemRevisionStatus"`
+	SubmittedItemRevisionStatus *itemRevisionStatusV2 `json:"submittedItemRevisionStatus"`
+	LastAsyncUploadState        string                `json:"lastAsyncUploadState"`
+}
+
+type deployInfoV2 struct {
+	DeployPercentage int `json:"deployPercentage"`
+}
+
+type publishRequestV2 struct {
+	PublishType string         `json:"publishType"`
+	DeployInfos []deployInfoV2 `json:"deployInfos,omitempty"`
+}
+
+type setDeployPercentageRequestV2 struct {
+	DeployPercentage int `json:"deployPercentage"`
+}
+
+type publishResponseV2 struct {
+	Name   string `json:"name"`
+	ItemID string `json:"itemId"`
+	State  string `json:"state"`
+}
+
+func (client ChromeWebstoreClient) itemURLV2(action string) string {
+	return fmt.Sprintf("%s/v2/publishers/%s/items/%s:%s", client.BaseURL, client.PublisherID, client.ApplicationID, action)
+}
+
+func (client ChromeWebstoreClient) uploadV2(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error) {
+	// Resumable uploads are not available on the v2 upload endpoint
+	res, err := client.sendPackage(ctx, "POST", fmt.Sprintf("%s/upload/v2/publishers/%s/items/%s:upload", client.BaseURL, client.PublisherID, client.ApplicationID), "application/zip", pkg)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("unable to upload zip file: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response uploadResponseV2
+	if err := decodeResponse(res, &response); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return UploadResult{}, apiErr
+		}
+		return UploadResult{}, fmt.Errorf("unable to get response when upload application: %v", err)
+	}
+
+	return UploadResult{
+		ID:          response.ItemID,
+		UploadState: uploadStateV2(response.UploadState),
+	}, nil
+}
+
+func (client ChromeWebstoreClient) fetchStatusV2(ctx context.Context) (fetchStatusResponseV2, error) {
+	req, err := client.newRequest(ctx, "GET", client.itemURLV2("fetchStatus"), nil, nil)
+	if err != nil {
+		return fetchStatusResponseV2{}, fmt.Errorf("unable to create status request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fetchStatusResponseV2{}, fmt.Errorf("unable to fetch status for application: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response fetchStatusResponseV2
+	if err := decodeResponse(res, &response); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return fetchStatusResponseV2{}, apiErr
+		}
+		return fetchStatusResponseV2{}, fmt.Errorf("unable to get response when fetch status for application: %v", err)
+	}
+
+	return response, nil
+}
+
+func (client ChromeWebstoreClient) getInfoV2(ctx context.Context, projection string) (Item, error) {
+	status, err := client.fetchStatusV2(ctx)
+	if err != nil {
+		return Item{}, err
+	}
+
+	item := Item{
+		ID:          status.ItemID,
+		UploadState: uploadStateV2(status.LastAsyncUploadState),
+	}
+
+	revision := status.PublishedItemRevisionStatus
+	if projection == ProjectionDraft && status.SubmittedItemRevisionStatus != nil {
+		revision = status.SubmittedItemRevisionStatus
+	}
+	if revision != nil && len(revision.DistributionChannels) > 0 {
+		item.CrxVersion = revision.DistributionChannels[0].CrxVersion
+	}
+
+	return item, nil
+}
+
+func (client ChromeWebstoreClient) publishV2(ctx context.Context, target string, deployPercentage *int) (PublishResult, error) {
+	if target != "default" {
+		return PublishResult{}, fmt.Errorf("publish target %s is not supported by API %s", target, APIVersion2)
+	}
+
+	body := publishRequestV2{PublishType: "DEFAULT_PUBLISH"}
+	if deployPercentage != nil {
+		body.DeployInfos = []deployInfoV2{{DeployPercentage: *deployPercentage}}
+	}
+
+	req, err := client.newJSONRequestV2(ctx, "publish", body)
+	if err != nil {
+		return PublishResult{}, fmt.Errorf("unable to create publish request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return PublishResult{}, fmt.Errorf("unable to publish application: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response publishResponseV2
+	if err := decodeResponse(res, &response); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return PublishResult{}, apiErr
+		}
+		return PublishResult{}, fmt.Errorf("unable to get response when publish application: %v", err)
+	}
+
+	result := PublishResult{
+		ItemID:       response.ItemID,
+		Status:       []string{publishStatusV2(response.State)},
+		StatusDetail: []string{fmt.Sprintf("item state is %s", response.State)},
+	}
+
+	if deployPercentage != nil && response.State == "PUBLISHED" {
+		// The publish is accepted, failing to read the percentage back leaves DeployPercentage unset
+		result.DeployPercentage = client.readDeployPercentageV2(ctx)
+	}
+
+	return result, nil
+}
+
+// setDeployPercentageV2 return the percentage read back from the store, nil when it can not be read
+func (client ChromeWebstoreClient) setDeployPercentageV2(ctx context.Context, percentage int) (*int, error) {
+	req, err := client.newJSONRequestV2(ctx, "setPublishedDeployPercentage", setDeployPercentageRequestV2{DeployPercentage: percentage})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create deploy percentage request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set deploy percentage: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct{}
+	if err := decodeResponse(res, &response); err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return nil, apiErr
+		}
+		return nil, fmt.Errorf("unable to get response when set deploy percentage: %v", err)
+	}
+
+	return client.readDeployPercentageV2(ctx), nil
+}
+
+func (client ChromeWebstoreClient) cancelSubmissionV2(ctx context.Context) (string, error) {
+	status, err := client.fetchStatusV2(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if status.SubmittedItemRevisionStatus == nil || status.SubmittedItemRevisionStatus.State != "PENDING_REVIEW" {
+		return "", fmt.Errorf("application %s has no submission pending review", client.ApplicationID)
+	}
+
+	req, err := client.newRequest(ctx, "POST", client.itemURLV2("cancelSubmission"), nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to create cancel request: %v", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to cancel submission: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct{}
+	if err := decodeResponse(res, &response); err != nil {
+		return "", fmt.Errorf("unable to get response when cancel submission: %v", err)
+	}
+
+	status, err = client.fetchStatusV2(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case status.SubmittedItemRevisionStatus != nil:
+		return status.SubmittedItemRevisionStatus.State, nil
+	case status.PublishedItemRevisionStatus != nil:
+		return status.PublishedItemRevisionStatus.State, nil
+	}
+
+	return "DRAFT", nil
+}
+
+// readDeployPercentageV2 return the deploy percentage of the published revision once it has been changed,
+// nil when it can not be read since the change is already accepted by the store
+func (client ChromeWebstoreClient) readDeployPercentageV2(ctx context.Context) *int {
+	effective, err := client.publishedDeployPercentageV2(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"id":    client.ApplicationID,
+			"error": err,
+		}).Warningln("unable to read the deploy percentage applied")
+
+		return nil
+	}
+
+	return &effective
+}
+
+// publishedDeployPercentageV2 return the deploy percentage of the published revision
+func (client ChromeWebstoreClient) publishedDeployPercentageV2(ctx context.Context) (int, error) {
+	status, err := client.fetchStatusV2(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	revision := status.PublishedItemRevisionStatus
+	if revision == nil || len(revision.DistributionChannels) == 0 {
+		return 0, fmt.Errorf("application %s has no published version", client.ApplicationID)
+	}
+
+	return revision.DistributionChannels[0].DeployPercentage, nil
+}
+
+func (client ChromeWebstoreClient) newJSONRequestV2(ctx context.Context, action string, v interface{}) (*http.Request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := client.newRequest(ctx, "POST", client.itemURLV2(action), nil, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// uploadStateV2 convert an upload state of API v2 to the v1.1 equivalent
+func uploadStateV2(state string) string {
+	switch state {
+	case "SUCCEEDED":
+		return UploadStateSuccess
+	case "FAILED":
+		return UploadStateFailure
+	case "":
+		return UploadStateNotFound
+	}
+
+	return state
+}
+
+// publishStatusV2 convert an item state of API v2 to the v1.1 publish status
+func publishStatusV2(state string) string {
+	switch state {
+	case "PUBLISHED", "PUBLISHED_TO_TESTERS", "STAGED":
+		return "OK"
+	case "PENDING_REVIEW":
+		return "ITEM_PENDING_REVIEW"
+	}
+
+	return "ITEM_" + state
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// crxMagic is the magic number at the beginning of CRX files
+const crxMagic = "Cr24"
+
+// Package is the zip archive of a prebuilt package, stripped of the CRX header if any
+type Package struct {
+	*io.SectionReader
+	// SHA256 is the checksum of the zip archive
+	SHA256 string
+	file   *os.File
+}
+
+// OpenPackage open a prebuilt zip archive, or a CRX2/CRX3 file, and check manifest.json is at the root of the archive.
+// The caller is responsible to close the package once used.
+func OpenPackage(path string) (*Package, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open package: %v", err)
+	}
+
+	pkg, err := newPackage(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid package %s: %v", path, err)
+	}
+
+	return pkg, nil
+}
+
+func newPackage(file *os.File) (*Package, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := crxZipOffset(file)
+	if err != nil {
+		return nil, err
+	}
+	if offset > info.Size() {
+		return nil, fmt.Errorf("CRX header larger than the file")
+	}
+
+	archive := io.NewSectionReader(file, offset, info.Size()-offset)
+	if err := validatePackage(archive, archive.Size()); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, archive); err != nil {
+		return nil, err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &Package{
+		SectionReader: archive,
+		SHA256:        hex.EncodeToString(hash.Sum(nil)),
+		file:          file,
+	}, nil
+}
+
+// Close release the file of the package
+func (p *Package) Close() error {
+	return p.file.Close()
+}
+
+// crxZipOffset return the offset of the zip archive in a CRX file, 0 when the file is not a CRX
+func crxZipOffset(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 16)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if n < 4 || string(header[:4]) != crxMagic {
+		return 0, nil
+	}
+	if n < 12 {
+		return 0, fmt.Errorf("truncated CRX header")
+	}
+
+	switch version := binary.LittleEndian.Uint32(header[4:8]); version {
+	case 2:
+		// Magic, version, public key length, signature length, public key, signature
+		if n < 16 {
+			return 0, fmt.Errorf("truncated CRX header")
+		}
+		publicKey := int64(binary.LittleEndian.Uint32(header[8:12]))
+		signature := int64(binary.LittleEndian.Uint32(header[12:16]))
+		return 16 + publicKey + signature, nil
+	case 3:
+		// Magic, version, header length, header
+		return 12 + int64(binary.LittleEndian.Uint32(header[8:12])), nil
+	default:
+		return 0, fmt.Errorf("unsupported CRX version %d", version)
+	}
+}
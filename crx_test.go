@@ -0,0 +1,128 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newZipContent return a zip archive containing a manifest at its root
+func newZipContent(t *testing.T) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`{"manifest_version": 3, "name": "test", "version": "1.0.0"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// crxHeader build a CRX header made of the magic number followed by the little endian fields
+func crxHeader(fields ...uint32) []byte {
+	header := []byte(crxMagic)
+	for _, field := range fields {
+		header = append(header, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(header[len(header)-4:], field)
+	}
+
+	return header
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestOpenPackage(t *testing.T) {
+	content := newZipContent(t)
+	checksum := sha256.Sum256(content)
+
+	tests := []struct {
+		name string
+		file []byte
+		// err is the beginning of the expected error, empty when the package is valid
+		err string
+	}{
+		{
+			name: "zip",
+			file: content,
+		},
+		{
+			name: "crx2",
+			file: concat(crxHeader(2, 3, 5), []byte("key"), []byte("signa"), content),
+		},
+		{
+			name: "crx3",
+			file: concat(crxHeader(3, 7), []byte("headers"), content),
+		},
+		{
+			name: "truncated header",
+			file: crxHeader(2),
+			err:  "truncated CRX header",
+		},
+		{
+			name: "truncated crx2 header",
+			file: crxHeader(2, 3),
+			err:  "truncated CRX header",
+		},
+		{
+			name: "unsupported version",
+			file: concat(crxHeader(4, 0), content),
+			err:  "unsupported CRX version 4",
+		},
+		{
+			name: "header larger than the file",
+			file: concat(crxHeader(3, 1<<20), content),
+			err:  "CRX header larger than the file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "drone-chromewebstore-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			if _, err := file.Write(tt.file); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			pkg, err := OpenPackage(file.Name())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer pkg.Close()
+
+			stripped, err := ioutil.ReadAll(pkg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stripped, content) {
+				t.Errorf("expected the zip archive of %d bytes, got %d bytes", len(content), len(stripped))
+			}
+			if pkg.SHA256 != hex.EncodeToString(checksum[:]) {
+				t.Errorf("expected SHA-256 %x, got %s", checksum, pkg.SHA256)
+			}
+		})
+	}
+}
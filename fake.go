@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mavimo/drone-chromewebstore/fakestore"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var serveFakeCommand = cli.Command{
+	Name:   "serve-fake",
+	Usage:  "Start a fake Chrome Webstore server, useful to test pipelines offline",
+	Action: serveFake,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "addr",
+			Usage: "Address the fake server listen on",
+			Value: "127.0.0.1:8080",
+		},
+		cli.IntFlag{
+			Name:  "in-progress-polls",
+			Usage: "Number of status checks answered with IN_PROGRESS after an in-progress upload",
+			Value: 1,
+		},
+		cli.StringSliceFlag{
+			Name:  "fail-token",
+			Usage: "Failures returned by the token endpoint, in order (rate-limit, server-error)",
+		},
+		cli.StringSliceFlag{
+			Name:  "fail-upload",
+			Usage: "Failures returned by the upload endpoint, in order (in-progress, version-conflict, rate-limit, server-error, interrupted)",
+		},
+		cli.StringSliceFlag{
+			Name:  "fail-get",
+			Usage: "Failures returned by the item endpoint, in order (rate-limit, server-error)",
+		},
+		cli.StringSliceFlag{
+			Name:  "fail-publish",
+			Usage: "Failures returned by the publish endpoint, in order (pending-review, rate-limit, server-error)",
+		},
+	},
+}
+
+func serveFake(c *cli.Context) error {
+	store := fakestore.New()
+	store.InProgressPolls = c.Int("in-progress-polls")
+
+	scripts := map[string]fakestore.Operation{
+		"fail-token":   fakestore.OperationToken,
+		"fail-upload":  fakestore.OperationUpload,
+		"fail-get":     fakestore.OperationGet,
+		"fail-publish": fakestore.OperationPublish,
+	}
+	for flag, op := range scripts {
+		for _, value := range c.StringSlice(flag) {
+			for _, name := range strings.Split(value, ",") {
+				failure, err := fakestore.ParseFailure(name)
+				if err != nil {
+					return cli.NewExitError(fmt.Errorf("invalid --%s value: %v", flag, err), ExitCodeError)
+				}
+				store.Script(op, failure)
+			}
+		}
+	}
+
+	addr := c.String("addr")
+	logrus.WithFields(logrus.Fields{
+		"api-base-url": "http://" + addr,
+		"token-url":    "http://" + addr + "/o/oauth2/token",
+	}).Infoln("fake Chrome Webstore server listening")
+
+	if err := http.ListenAndServe(addr, store); err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+
+	return nil
+}
@@ -0,0 +1,460 @@
+// Package fakestore provide an in-memory emulation of the Chrome Webstore API,
+// useful to run the plugin end to end without reaching Google services.
+package fakestore
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens released by the fake token endpoint
+const (
+	AccessToken  = "fake-access-token"
+	RefreshToken = "fake-refresh-token"
+)
+
+// Operation identify an endpoint exposed by the fake store
+type Operation string
+
+// Operations exposed by the fake store
+const (
+	OperationToken   Operation = "token"
+	OperationUpload  Operation = "upload"
+	OperationGet     Operation = "get"
+	OperationPublish Operation = "publish"
+)
+
+// Failure identify a failure mode the fake store can simulate
+type Failure string
+
+// Failure modes supported by the fake store
+const (
+	FailureInProgress      Failure = "in-progress"
+	FailureVersionConflict Failure = "version-conflict"
+	FailureRateLimit       Failure = "rate-limit"
+	FailureServerError     Failure = "server-error"
+	FailurePendingReview   Failure = "pending-review"
+	// FailureInterrupted close the connection in the middle of a resumable upload chunk
+	FailureInterrupted Failure = "interrupted"
+)
+
+// ParseFailure convert a failure name into a Failure
+func ParseFailure(name string) (Failure, error) {
+	switch f := Failure(strings.TrimSpace(name)); f {
+	case FailureInProgress, FailureVersionConflict, FailureRateLimit, FailureServerError, FailurePendingReview, FailureInterrupted:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unknown failure %q", name)
+}
+
+// Item is the state of an application stored in the fake store
+type Item struct {
+	ID               string
+	UploadState      string
+	CrxVersion       string
+	PublishedVersion string
+	PublishTarget    string
+	DeployPercentage int
+	State            string
+	Package          []byte
+	pendingPolls     int
+}
+
+// Server emulate Chrome Webstore API and Google OAuth token endpoint
+type Server struct {
+	// InProgressPolls is the number of status requests answered with IN_PROGRESS
+	// after an upload scripted with FailureInProgress
+	InProgressPolls int
+
+	mu       sync.Mutex
+	items    map[string]*Item
+	failures map[Operation][]Failure
+	// challenges contains the PKCE challenge of each authorization code released
+	challenges map[string]string
+	sessions   map[string]*uploadSession
+}
+
+// New create a new fake store without items
+func New() *Server {
+	return &Server{
+		InProgressPolls: 1,
+		items:           map[string]*Item{},
+		failures:        map[Operation][]Failure{},
+		challenges:      map[string]string{},
+		sessions:        map[string]*uploadSession{},
+	}
+}
+
+// Script enqueue failures for an operation, each request consume the first failure in the queue
+func (s *Server) Script(op Operation, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[op] = append(s.failures[op], failures...)
+}
+
+// Item return a copy of the state of an item
+func (s *Server) Item(id string) (Item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return Item{}, false
+	}
+
+	return *item, true
+}
+
+func (s *Server) nextFailure(op Operation) Failure {
+	queue := s.failures[op]
+	if len(queue) == 0 {
+		return ""
+	}
+	s.failures[op] = queue[1:]
+
+	return queue[0]
+}
+
+func (s *Server) item(id string) *Item {
+	item, ok := s.items[id]
+	if !ok {
+		item = &Item{ID: id, UploadState: "NOT_FOUND"}
+		s.items[id] = item
+	}
+
+	return item
+}
+
+// ServeHTTP dispatch requests to the emulated endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The body is read before locking the store, so a slow client does not block the other requests
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/o/oauth2/token" || r.URL.Path == "/token" {
+		s.serveToken(w, r)
+		return
+	}
+
+	if r.URL.Path == "/o/oauth2/auth" {
+		s.serveConsent(w, r)
+		return
+	}
+
+	if r.URL.Path == "/v1/token" {
+		s.serveTokenExchange(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		writeError(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+
+	if r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/v1/projects/-/serviceAccounts/") && strings.HasSuffix(r.URL.Path, ":generateAccessToken") {
+		s.serveGenerateAccessToken(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/upload/v2/") || strings.HasPrefix(r.URL.Path, "/v2/") {
+		s.serveV2(w, r)
+		return
+	}
+
+	s.serveV1(w, r)
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationToken)) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.PostForm.Get("grant_type") == "refresh_token" && r.PostForm.Get("refresh_token") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	res := map[string]interface{}{
+		"access_token": AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+
+	if r.PostForm.Get("grant_type") == "authorization_code" {
+		code := r.PostForm.Get("code")
+		challenge, ok := s.challenges[code]
+		delete(s.challenges, code)
+
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || challenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		res["refresh_token"] = RefreshToken
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// serveConsent grant the access immediately, redirecting to the client with an authorization code
+func (s *Server) serveConsent(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("code_challenge_method") != "S256" {
+		writeError(w, http.StatusBadRequest, "invalid consent request")
+		return
+	}
+
+	code := fmt.Sprintf("fake-code-%d", len(s.challenges)+1)
+	s.challenges[code] = query.Get("code_challenge")
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// serveTokenExchange emulate the security token service used by workload identity federation
+func (s *Server) serveTokenExchange(w http.ResponseWriter, r *http.Request) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationToken)) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:token-exchange" || r.PostForm.Get("subject_token") == "" || r.PostForm.Get("audience") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":      AccessToken,
+		"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+		"token_type":        "Bearer",
+		"expires_in":        3600,
+	})
+}
+
+// serveGenerateAccessToken emulate the service account impersonation API
+func (s *Server) serveGenerateAccessToken(w http.ResponseWriter, r *http.Request) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationToken)) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"accessToken": AccessToken,
+		"expireTime":  time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+}
+
+// upload store a new package for the item, returning the errors that caused its refusal
+func (s *Server) upload(id string, body []byte, failure Failure) (*Item, []itemError) {
+	item := s.item(id)
+
+	version, err := manifestVersion(body)
+	if err != nil {
+		item.UploadState = "FAILURE"
+		return item, []itemError{{ErrorCode: "PKG_INVALID_ZIP", ErrorDetail: err.Error()}}
+	}
+
+	if failure == FailureVersionConflict || (item.CrxVersion != "" && compareVersions(version, item.CrxVersion) <= 0) {
+		item.UploadState = "FAILURE"
+		return item, []itemError{{
+			ErrorCode:   "PKG_INVALID_VERSION_NUMBER",
+			ErrorDetail: fmt.Sprintf("The version in the manifest must be greater than the version %s already uploaded.", item.CrxVersion),
+		}}
+	}
+
+	item.CrxVersion = version
+	item.Package = body
+	item.State = ""
+	item.UploadState = "SUCCESS"
+	if failure == FailureInProgress {
+		item.UploadState = "IN_PROGRESS"
+		item.pendingPolls = s.InProgressPolls
+	}
+
+	return item, nil
+}
+
+// setDeployPercentage change the deploy percentage of the published version
+func (s *Server) setDeployPercentage(id string, deployPercentage int) error {
+	item, ok := s.items[id]
+	if !ok || item.PublishedVersion == "" {
+		return fmt.Errorf("item %s has no published version", id)
+	}
+
+	if deployPercentage < item.DeployPercentage {
+		return fmt.Errorf("deploy percentage can not be decreased from %d to %d", item.DeployPercentage, deployPercentage)
+	}
+	item.DeployPercentage = deployPercentage
+
+	return nil
+}
+
+// cancelSubmission cancel the submission pending review
+func (s *Server) cancelSubmission(id string) error {
+	item, ok := s.items[id]
+	if !ok || item.State != "PENDING_REVIEW" {
+		return fmt.Errorf("item %s has no submission pending review", id)
+	}
+	item.State = ""
+
+	return nil
+}
+
+// poll return the item, completing in progress uploads once enough status requests are received
+func (s *Server) poll(id string) (*Item, bool) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	if item.UploadState == "IN_PROGRESS" {
+		if item.pendingPolls <= 0 {
+			item.UploadState = "SUCCESS"
+		}
+		item.pendingPolls--
+	}
+
+	return item, true
+}
+
+// publish submit the last uploaded package, returning the v1.1 status and its detail
+func (s *Server) publish(id string, target string, deployPercentage int, failure Failure) (string, string) {
+	item, ok := s.items[id]
+	if !ok {
+		return "ITEM_NOT_FOUND", fmt.Sprintf("Item %s not found.", id)
+	}
+
+	if item.UploadState != "SUCCESS" {
+		return "ITEM_NOT_UPDATABLE", fmt.Sprintf("Upload state is %s.", item.UploadState)
+	}
+
+	item.PublishTarget = target
+	if failure == FailurePendingReview {
+		item.State = "PENDING_REVIEW"
+		return "ITEM_PENDING_REVIEW", "The item is pending review."
+	}
+
+	item.State = "PUBLISHED"
+	item.PublishedVersion = item.CrxVersion
+	item.DeployPercentage = deployPercentage
+
+	return "OK", "Publish item request has been accepted."
+}
+
+// writeTransientFailure write the response for failures not related to the item state
+func (s *Server) writeTransientFailure(w http.ResponseWriter, failure Failure) bool {
+	switch failure {
+	case FailureRateLimit:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return true
+	case FailureServerError:
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return true
+	}
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+		},
+	})
+}
+
+// manifestVersion extract the version declared in the manifest.json contained in the archive
+func manifestVersion(content []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("unable to read package: %v", err)
+	}
+
+	for _, f := range r.File {
+		if f.Name != "manifest.json" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("unable to open manifest: %v", err)
+		}
+		defer rc.Close()
+
+		var manifest struct {
+			Version string `json:"version"`
+		}
+		if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+			return "", fmt.Errorf("unable to decode manifest: %v", err)
+		}
+
+		return manifest.Version, nil
+	}
+
+	return "", fmt.Errorf("manifest.json not found in package root")
+}
+
+// compareVersions compare two dotted versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,51 @@
+package fakestore
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSlowUploadDoesNotBlockOtherRequests(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+
+	// The upload body is never completed while the token is requested
+	body, writer := io.Pipe()
+	defer writer.Close()
+
+	req, err := http.NewRequest("PUT", server.URL+"/upload/chromewebstore/v1.1/items/app1", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+AccessToken)
+	go func() {
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+		}
+	}()
+	if _, err := writer.Write([]byte("PK")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		res, err := http.PostForm(server.URL+"/o/oauth2/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {RefreshToken}})
+		if err == nil {
+			res.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token request blocked by the pending upload")
+	}
+}
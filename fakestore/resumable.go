@@ -0,0 +1,121 @@
+package fakestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// uploadSession is a resumable upload in progress
+type uploadSession struct {
+	total int64
+	data  []byte
+	// complete store the package once all bytes are received, returning the upload response
+	complete func(body []byte) interface{}
+	response interface{}
+}
+
+// startUploadSession create a resumable upload session and return its URL in the Location header
+func (s *Server) startUploadSession(w http.ResponseWriter, r *http.Request, complete func(body []byte) interface{}) {
+	total, err := strconv.ParseInt(r.Header.Get("X-Upload-Content-Length"), 10, 64)
+	if err != nil || total < 0 {
+		writeError(w, http.StatusBadRequest, "invalid X-Upload-Content-Length header")
+		return
+	}
+
+	id := strconv.Itoa(len(s.sessions) + 1)
+	s.sessions[id] = &uploadSession{total: total, complete: complete}
+
+	location := *r.URL
+	location.Scheme = "http"
+	location.Host = r.Host
+	query := location.Query()
+	query.Del("uploadType")
+	query.Set("upload_id", id)
+	location.RawQuery = query.Encode()
+
+	w.Header().Set("Location", location.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveUploadChunk append a chunk to the session, or report the bytes received when the chunk is empty
+func (s *Server) serveUploadChunk(w http.ResponseWriter, r *http.Request, session *uploadSession) {
+	if session.response != nil {
+		writeJSON(w, http.StatusOK, session.response)
+		return
+	}
+
+	if s.writeTransientFailure(w, s.nextFailureIn(OperationUpload, FailureRateLimit, FailureServerError)) {
+		return
+	}
+
+	var start, end, total int64
+	contentRange := r.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(contentRange, "bytes */%d", &total); err == nil {
+		s.writeUploadOffset(w, session)
+		return
+	}
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil || total != session.total || end < start {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid Content-Range header %q", contentRange))
+		return
+	}
+	if start != int64(len(session.data)) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("chunk starts at %d, %d bytes received", start, len(session.data)))
+		return
+	}
+
+	chunk, err := ioutil.ReadAll(io.LimitReader(r.Body, end-start+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.nextFailureIn(OperationUpload, FailureInterrupted) == FailureInterrupted {
+		// Keep half of the chunk, then drop the connection like an unreliable link would do
+		session.data = append(session.data, chunk[:len(chunk)/2]...)
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		writeError(w, http.StatusServiceUnavailable, "connection interrupted")
+		return
+	}
+
+	session.data = append(session.data, chunk...)
+	if int64(len(session.data)) < session.total {
+		s.writeUploadOffset(w, session)
+		return
+	}
+
+	session.response = session.complete(session.data)
+	writeJSON(w, http.StatusOK, session.response)
+}
+
+// writeUploadOffset answer 308 with the range of bytes received
+func (s *Server) writeUploadOffset(w http.ResponseWriter, session *uploadSession) {
+	if len(session.data) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(session.data)-1))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+// nextFailureIn consume the next failure of the operation only if it is one of the given failures,
+// so failures related to the package are kept for the completion of resumable uploads
+func (s *Server) nextFailureIn(op Operation, failures ...Failure) Failure {
+	queue := s.failures[op]
+	if len(queue) == 0 {
+		return ""
+	}
+
+	for _, failure := range failures {
+		if queue[0] == failure {
+			return s.nextFailure(op)
+		}
+	}
+
+	return ""
+}
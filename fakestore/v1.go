@@ -0,0 +1,164 @@
+package fakestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type itemError struct {
+	ErrorCode   string `json:"error_code"`
+	ErrorDetail string `json:"error_detail"`
+}
+
+type itemResource struct {
+	Kind        string      `json:"kind"`
+	ID          string      `json:"id"`
+	PublicKey   string      `json:"publicKey,omitempty"`
+	UploadState string      `json:"uploadState"`
+	CrxVersion  string      `json:"crxVersion,omitempty"`
+	ItemError   []itemError `json:"itemError,omitempty"`
+}
+
+type publishResource struct {
+	Kind         string   `json:"kind"`
+	ItemID       string   `json:"item_id"`
+	Status       []string `json:"status"`
+	StatusDetail []string `json:"statusDetail"`
+}
+
+// serveV1 dispatch requests to the v1.1 endpoints
+func (s *Server) serveV1(w http.ResponseWriter, r *http.Request) {
+	const uploadPrefix = "/upload/chromewebstore/v1.1/items/"
+	const itemsPrefix = "/chromewebstore/v1.1/items/"
+
+	switch {
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, uploadPrefix):
+		s.serveUploadV1(w, r, strings.TrimPrefix(r.URL.Path, uploadPrefix))
+	case r.Method == "POST" && strings.HasPrefix(r.URL.Path, itemsPrefix) && strings.HasSuffix(r.URL.Path, "/publish"):
+		s.servePublishV1(w, r, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, itemsPrefix), "/publish"))
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, itemsPrefix):
+		s.serveGetV1(w, r, strings.TrimPrefix(r.URL.Path, itemsPrefix))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveUploadV1(w http.ResponseWriter, r *http.Request, id string) {
+	if session, ok := s.sessions[r.URL.Query().Get("upload_id")]; ok {
+		s.serveUploadChunk(w, r, session)
+		return
+	}
+
+	if r.URL.Query().Get("uploadType") == "resumable" {
+		if s.writeTransientFailure(w, s.nextFailureIn(OperationUpload, FailureRateLimit, FailureServerError)) {
+			return
+		}
+
+		s.startUploadSession(w, r, func(body []byte) interface{} {
+			return s.uploadV1(id, body, s.nextFailure(OperationUpload))
+		})
+		return
+	}
+
+	failure := s.nextFailure(OperationUpload)
+	if s.writeTransientFailure(w, failure) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.uploadV1(id, body, failure))
+}
+
+func (s *Server) uploadV1(id string, body []byte, failure Failure) itemResource {
+	item, errs := s.upload(id, body, failure)
+	res := itemResource{
+		Kind:        "chromewebstore#item",
+		ID:          id,
+		UploadState: item.UploadState,
+		ItemError:   errs,
+	}
+	if errs == nil {
+		res.CrxVersion = item.CrxVersion
+	}
+
+	return res
+}
+
+func (s *Server) serveGetV1(w http.ResponseWriter, r *http.Request, id string) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationGet)) {
+		return
+	}
+
+	item, ok := s.poll(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("item %s not found", id))
+		return
+	}
+
+	res := itemResource{
+		Kind:        "chromewebstore#item",
+		ID:          item.ID,
+		UploadState: item.UploadState,
+		CrxVersion:  item.CrxVersion,
+	}
+	if r.URL.Query().Get("projection") == "PUBLISHED" {
+		res.CrxVersion = item.PublishedVersion
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) servePublishV1(w http.ResponseWriter, r *http.Request, id string) {
+	failure := s.nextFailure(OperationPublish)
+	if s.writeTransientFailure(w, failure) {
+		return
+	}
+
+	target := r.URL.Query().Get("publishTarget")
+	if target == "" {
+		target = "default"
+	}
+
+	deployPercentage := 100
+	if value := r.URL.Query().Get("deployPercentage"); value != "" {
+		var err error
+		if deployPercentage, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Publishing an already published version only change its deploy percentage
+	if item, ok := s.items[id]; ok && item.State == "PUBLISHED" && item.PublishedVersion == item.CrxVersion {
+		status, detail := "OK", "Item is already published."
+		if r.URL.Query().Get("deployPercentage") != "" {
+			detail = "Deploy percentage has been updated."
+		}
+		if err := s.setDeployPercentage(id, deployPercentage); err != nil {
+			status, detail = "ITEM_NOT_UPDATABLE", err.Error()
+		}
+		writeJSON(w, http.StatusOK, publishResource{
+			Kind:         "chromewebstore#item",
+			ItemID:       id,
+			Status:       []string{status},
+			StatusDetail: []string{detail},
+		})
+		return
+	}
+
+	status, detail := s.publish(id, target, deployPercentage, failure)
+	writeJSON(w, http.StatusOK, publishResource{
+		Kind:         "chromewebstore#item",
+		ItemID:       id,
+		Status:       []string{status},
+		StatusDetail: []string{detail},
+	})
+}
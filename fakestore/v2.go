@@ -0,0 +1,203 @@
+package fakestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type distributionChannelV2 struct {
+	DeployPercentage int    `json:"deployPercentage"`
+	CrxVersion       string `json:"crxVersion"`
+}
+
+type itemRevisionStatusV2 struct {
+	State                string                  `json:"state"`
+	DistributionChannels []distributionChannelV2 `json:"distributionChannels"`
+}
+
+type fetchStatusResourceV2 struct {
+	Name                        string                `json:"name"`
+	ItemID                      string                `json:"itemId"`
+	PublishedItemRevisionStatus *itemRevisionStatusV2 `json:"publishedItemRevisionStatus,omitempty"`
+	SubmittedItemRevisionStatus *itemRevisionStatusV2 `json:"submittedItemRevisionStatus,omitempty"`
+	LastAsyncUploadState        string                `json:"lastAsyncUploadState,omitempty"`
+}
+
+// serveV2 dispatch requests to the v2 endpoints, in the form publishers/{publisherId}/items/{itemId}:{action}
+func (s *Server) serveV2(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/upload"), "/v2/publishers/")
+
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[1] != "items" || !strings.Contains(parts[2], ":") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	publisher := parts[0]
+	id := parts[2][:strings.LastIndex(parts[2], ":")]
+	action := parts[2][strings.LastIndex(parts[2], ":")+1:]
+	name := fmt.Sprintf("publishers/%s/items/%s", publisher, id)
+
+	switch {
+	case r.Method == "POST" && action == "upload":
+		s.serveUploadV2(w, r, name, id)
+	case r.Method == "GET" && action == "fetchStatus":
+		s.serveFetchStatusV2(w, r, name, id)
+	case r.Method == "POST" && action == "publish":
+		s.servePublishV2(w, r, name, id)
+	case r.Method == "POST" && action == "cancelSubmission":
+		s.serveCancelSubmissionV2(w, r, id)
+	case r.Method == "POST" && action == "setPublishedDeployPercentage":
+		s.serveSetDeployPercentageV2(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) serveUploadV2(w http.ResponseWriter, r *http.Request, name, id string) {
+	failure := s.nextFailure(OperationUpload)
+	if s.writeTransientFailure(w, failure) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	item, errs := s.upload(id, body, failure)
+	if errs != nil {
+		writeError(w, http.StatusBadRequest, errs[0].ErrorDetail)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"name":        name,
+		"itemId":      id,
+		"crxVersion":  item.CrxVersion,
+		"uploadState": uploadStateV2(item.UploadState),
+	})
+}
+
+func (s *Server) serveFetchStatusV2(w http.ResponseWriter, r *http.Request, name, id string) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationGet)) {
+		return
+	}
+
+	item, ok := s.poll(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("item %s not found", id))
+		return
+	}
+
+	res := fetchStatusResourceV2{
+		Name:                 name,
+		ItemID:               id,
+		LastAsyncUploadState: uploadStateV2(item.UploadState),
+	}
+	if item.PublishedVersion != "" {
+		res.PublishedItemRevisionStatus = &itemRevisionStatusV2{
+			State:                "PUBLISHED",
+			DistributionChannels: []distributionChannelV2{{DeployPercentage: item.DeployPercentage, CrxVersion: item.PublishedVersion}},
+		}
+	}
+	if item.State == "PENDING_REVIEW" {
+		res.SubmittedItemRevisionStatus = &itemRevisionStatusV2{
+			State:                item.State,
+			DistributionChannels: []distributionChannelV2{{DeployPercentage: 100, CrxVersion: item.CrxVersion}},
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) servePublishV2(w http.ResponseWriter, r *http.Request, name, id string) {
+	failure := s.nextFailure(OperationPublish)
+	if s.writeTransientFailure(w, failure) {
+		return
+	}
+
+	var body struct {
+		DeployInfos []distributionChannelV2 `json:"deployInfos"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deployPercentage := 100
+	if len(body.DeployInfos) > 0 {
+		deployPercentage = body.DeployInfos[0].DeployPercentage
+	}
+
+	status, detail := s.publish(id, "default", deployPercentage, failure)
+
+	var state string
+	switch status {
+	case "OK":
+		state = "PUBLISHED"
+	case "ITEM_PENDING_REVIEW":
+		state = "PENDING_REVIEW"
+	case "ITEM_NOT_FOUND":
+		writeError(w, http.StatusNotFound, detail)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, detail)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"name":   name,
+		"itemId": id,
+		"state":  state,
+	})
+}
+
+func (s *Server) serveSetDeployPercentageV2(w http.ResponseWriter, r *http.Request, id string) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationPublish)) {
+		return
+	}
+
+	var body struct {
+		DeployPercentage int `json:"deployPercentage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.setDeployPercentage(id, body.DeployPercentage); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) serveCancelSubmissionV2(w http.ResponseWriter, r *http.Request, id string) {
+	if s.writeTransientFailure(w, s.nextFailure(OperationPublish)) {
+		return
+	}
+
+	if err := s.cancelSubmission(id); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func uploadStateV2(state string) string {
+	switch state {
+	case "SUCCESS":
+		return "SUCCEEDED"
+	case "FAILURE":
+		return "FAILED"
+	}
+
+	return state
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mavimo/drone-chromewebstore/fakestore"
+)
+
+// newSource create a source folder containing a manifest with the given version,
+// the caller is responsible to remove it
+func newSource(t *testing.T, version string) string {
+	dir, err := ioutil.TempDir("", "drone-chromewebstore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := `{"manifest_version": 3, "name": "test", "version": "` + version + `"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// newFakeStorePlugin return a plugin uploading and publishing source to the fake store served by server
+func newFakeStorePlugin(server *httptest.Server, source string) Plugin {
+	return Plugin{
+		ApplicationID: "app1",
+		API: API{
+			BaseURL:    server.URL,
+			UploadMode: UploadModeResumable,
+			Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		},
+		Authentication: Authentication{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RefreshToken: fakestore.RefreshToken,
+			TokenURL:     server.URL + "/o/oauth2/token",
+		},
+		Config: Config{
+			Source:        source,
+			Upload:        true,
+			Publish:       true,
+			PublishTarget: "default",
+			PollInterval:  10 * time.Millisecond,
+			PollTimeout:   time.Second,
+		},
+	}
+}
+
+func TestExecFakeStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// apiVersion and target override the API version and the publish target when set
+		apiVersion string
+		target     string
+		failures   map[fakestore.Operation][]fakestore.Failure
+		exitCode   int
+		// state and published are the expected state of the item in the store
+		state     string
+		published string
+	}{
+		{
+			name:      "published",
+			state:     "PUBLISHED",
+			published: "1.0.0",
+		},
+		{
+			name:      "upload in progress",
+			failures:  map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureInProgress}},
+			state:     "PUBLISHED",
+			published: "1.0.0",
+		},
+		{
+			name:     "version conflict",
+			failures: map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureVersionConflict}},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:      "upload rate limited retried",
+			failures:  map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureRateLimit}},
+			state:     "PUBLISHED",
+			published: "1.0.0",
+		},
+		{
+			name:     "upload server error",
+			failures: map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureServerError}},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:      "upload interrupted resumed",
+			failures:  map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureInterrupted}},
+			state:     "PUBLISHED",
+			published: "1.0.0",
+		},
+		{
+			name:     "publish server error",
+			failures: map[fakestore.Operation][]fakestore.Failure{fakestore.OperationPublish: {fakestore.FailureServerError}},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:     "pending review",
+			failures: map[fakestore.Operation][]fakestore.Failure{fakestore.OperationPublish: {fakestore.FailurePendingReview}},
+			exitCode: ExitCodePendingReview,
+			state:    "PENDING_REVIEW",
+		},
+		{
+			name:       "v2 published",
+			apiVersion: APIVersion2,
+			state:      "PUBLISHED",
+			published:  "1.0.0",
+		},
+		{
+			name:       "v2 pending review",
+			apiVersion: APIVersion2,
+			failures:   map[fakestore.Operation][]fakestore.Failure{fakestore.OperationPublish: {fakestore.FailurePendingReview}},
+			exitCode:   ExitCodePendingReview,
+			state:      "PENDING_REVIEW",
+		},
+		{
+			name:       "v2 upload in progress",
+			apiVersion: APIVersion2,
+			failures:   map[fakestore.Operation][]fakestore.Failure{fakestore.OperationUpload: {fakestore.FailureInProgress}},
+			state:      "PUBLISHED",
+			published:  "1.0.0",
+		},
+		{
+			name:       "v2 trusted testers rejected",
+			apiVersion: APIVersion2,
+			target:     "trustedTesters",
+			exitCode:   ExitCodeError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fakestore.New()
+			for op, failures := range tt.failures {
+				store.Script(op, failures...)
+			}
+			server := httptest.NewServer(store)
+			defer server.Close()
+
+			source := newSource(t, "1.0.0")
+			defer os.RemoveAll(source)
+
+			p := newFakeStorePlugin(server, source)
+			if tt.apiVersion != "" {
+				p.API.Version = tt.apiVersion
+				p.API.PublisherID = "pub1"
+			}
+			if tt.target != "" {
+				p.Config.PublishTarget = tt.target
+			}
+
+			err := p.Exec(context.Background())
+			if tt.exitCode == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.exitCode != 0 {
+				if err == nil {
+					t.Fatalf("expected exit code %d, got no error", tt.exitCode)
+				}
+				if code := exitCode(err); code != tt.exitCode {
+					t.Errorf("expected exit code %d, got %d: %v", tt.exitCode, code, err)
+				}
+			}
+
+			item, _ := store.Item("app1")
+			if item.State != tt.state || item.PublishedVersion != tt.published {
+				t.Errorf("expected item %s with version %q published, got %s with %q", tt.state, tt.published, item.State, item.PublishedVersion)
+			}
+		})
+	}
+}
+
+func TestExecFakeStoreConcurrentApplications(t *testing.T) {
+	store := fakestore.New()
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	source := newSource(t, "1.0.0")
+	defer os.RemoveAll(source)
+
+	p := newFakeStorePlugin(server, source)
+	p.ApplicationID = ""
+	p.Applications = []Application{{ID: "app1"}, {ID: "app2"}, {ID: "app3"}}
+	p.Config.Concurrency = 3
+
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, application := range p.Applications {
+		if item, _ := store.Item(application.ID); item.PublishedVersion != "1.0.0" {
+			t.Errorf("expected version 1.0.0 of %s published, got %q", application.ID, item.PublishedVersion)
+		}
+	}
+}
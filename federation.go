@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Default endpoints used by workload identity federation
+const (
+	DefaultSTSURL           = "https://sts.googleapis.com/v1/token"
+	DefaultImpersonationURL = "https://iamcredentials.googleapis.com"
+)
+
+// WorkloadIdentity contains settings required to exchange an OIDC token issued by the CI for a Google access token
+type WorkloadIdentity struct {
+	// Provider is the full resource name of the workload identity provider
+	Provider string
+	// OIDCToken is the ID token issued by the CI, read from OIDCTokenFile when empty
+	OIDCToken     string
+	OIDCTokenFile string
+	// ServiceAccount is the email of the service account to impersonate, optional
+	ServiceAccount   string
+	STSURL           string
+	ImpersonationURL string
+}
+
+// Enabled indicate if an OIDC token has been configured
+func (w WorkloadIdentity) Enabled() bool {
+	return w.OIDCToken != "" || w.OIDCTokenFile != ""
+}
+
+type federatedTokenSource struct {
+	ctx      context.Context
+	identity WorkloadIdentity
+	scope    string
+}
+
+// newFederatedTokenSource return a token source exchanging the OIDC token at the STS endpoint
+func newFederatedTokenSource(ctx context.Context, identity WorkloadIdentity, scope string) (oauth2.TokenSource, error) {
+	if identity.Provider == "" {
+		return nil, fmt.Errorf("workload identity provider is required to use an OIDC token")
+	}
+
+	return oauth2.ReuseTokenSource(nil, federatedTokenSource{ctx, identity, scope}), nil
+}
+
+// Token exchange the OIDC token, then impersonate the service account if configured
+func (ts federatedTokenSource) Token() (*oauth2.Token, error) {
+	subject, err := ts.subjectToken()
+	if err != nil {
+		return nil, err
+	}
+
+	scope := ts.scope
+	if ts.identity.ServiceAccount != "" {
+		// The federated token is used only to call the impersonation API
+		scope = "https://www.googleapis.com/auth/cloud-platform"
+	}
+
+	tkn, err := ts.exchange(subject, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if ts.identity.ServiceAccount == "" {
+		return tkn, nil
+	}
+
+	return ts.impersonate(tkn)
+}
+
+func (ts federatedTokenSource) subjectToken() (string, error) {
+	if ts.identity.OIDCToken != "" {
+		return strings.TrimSpace(ts.identity.OIDCToken), nil
+	}
+
+	// The file is read each time since the CI may rotate the token
+	content, err := ioutil.ReadFile(ts.identity.OIDCTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read OIDC token: %v", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (ts federatedTokenSource) exchange(subject, scope string) (*oauth2.Token, error) {
+	audience := ts.identity.Provider
+	if !strings.HasPrefix(audience, "//") {
+		audience = "//iam.googleapis.com/" + strings.TrimPrefix(audience, "/")
+	}
+
+	stsURL := ts.identity.STSURL
+	if stsURL == "" {
+		stsURL = DefaultSTSURL
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	form.Set("audience", audience)
+	form.Set("scope", scope)
+	form.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	form.Set("subject_token", subject)
+	form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:jwt")
+
+	req, err := http.NewRequest("POST", stsURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create token exchange request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := contextClient(ts.ctx).Do(req.WithContext(ts.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange OIDC token: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := decodeResponse(res, &response); err != nil {
+		return nil, fmt.Errorf("unable to exchange OIDC token: %v", err)
+	}
+	if response.AccessToken == "" {
+		return nil, fmt.Errorf("unable to exchange OIDC token: server response missing access_token")
+	}
+	// A token without expiration would be exchanged again before each request
+	if response.ExpiresIn <= 0 {
+		return nil, fmt.Errorf("unable to exchange OIDC token: server response missing expires_in")
+	}
+
+	return &oauth2.Token{
+		AccessToken: response.AccessToken,
+		TokenType:   response.TokenType,
+		Expiry:      time.Now().Add(time.Duration(response.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func (ts federatedTokenSource) impersonate(federated *oauth2.Token) (*oauth2.Token, error) {
+	baseURL := ts.identity.ImpersonationURL
+	if baseURL == "" {
+		baseURL = DefaultImpersonationURL
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    []string{ts.scope},
+		"lifetime": "3600s",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode impersonation request: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/projects/-/serviceAccounts/%s:generateAccessToken", strings.TrimSuffix(baseURL, "/"), url.PathEscape(ts.identity.ServiceAccount))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create impersonation request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	federated.SetAuthHeader(req)
+
+	res, err := contextClient(ts.ctx).Do(req.WithContext(ts.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to impersonate service account %s: %v", ts.identity.ServiceAccount, err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := decodeResponse(res, &response); err != nil {
+		return nil, fmt.Errorf("unable to impersonate service account %s: %v", ts.identity.ServiceAccount, err)
+	}
+	if response.AccessToken == "" || response.ExpireTime.IsZero() {
+		return nil, fmt.Errorf("unable to impersonate service account %s: server response missing accessToken or expireTime", ts.identity.ServiceAccount)
+	}
+
+	return &oauth2.Token{
+		AccessToken: response.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      response.ExpireTime,
+	}, nil
+}
+
+// contextClient return the HTTP client stored in the context, as done by oauth2 package
+func contextClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		return client
+	}
+
+	return http.DefaultClient
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mavimo/drone-chromewebstore/fakestore"
+)
+
+// newWorkloadIdentity return a workload identity exchanging its OIDC token with the fake store served by server
+func newWorkloadIdentity(server *httptest.Server, serviceAccount string) WorkloadIdentity {
+	return WorkloadIdentity{
+		Provider:         "projects/1/locations/global/workloadIdentityPools/ci/providers/drone",
+		OIDCToken:        "oidc-token",
+		ServiceAccount:   serviceAccount,
+		STSURL:           server.URL + "/v1/token",
+		ImpersonationURL: server.URL,
+	}
+}
+
+func TestExecFakeStoreWorkloadIdentity(t *testing.T) {
+	tests := []struct {
+		name           string
+		serviceAccount string
+	}{
+		{name: "federated token"},
+		{name: "impersonation", serviceAccount: "deploy@project.iam.gserviceaccount.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fakestore.New()
+			server := httptest.NewServer(store)
+			defer server.Close()
+
+			source := newSource(t, "1.0.0")
+			defer os.RemoveAll(source)
+
+			p := newFakeStorePlugin(server, source)
+			p.Authentication = Authentication{WorkloadIdentity: newWorkloadIdentity(server, tt.serviceAccount)}
+
+			if err := p.Exec(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item, _ := store.Item("app1"); item.PublishedVersion != "1.0.0" {
+				t.Errorf("expected version 1.0.0 published, got %q", item.PublishedVersion)
+			}
+		})
+	}
+}
+
+func TestFederatedTokenInvalidResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		serviceAccount string
+		// path is the endpoint answering body, the other ones are served by the fake store
+		path string
+		body string
+		err  string
+	}{
+		{
+			name: "missing access token",
+			path: "/v1/token",
+			body: `{"token_type":"Bearer","expires_in":3600}`,
+			err:  "server response missing access_token",
+		},
+		{
+			name: "missing expiration",
+			path: "/v1/token",
+			body: `{"access_token":"` + fakestore.AccessToken + `","token_type":"Bearer"}`,
+			err:  "server response missing expires_in",
+		},
+		{
+			name:           "impersonation missing access token",
+			serviceAccount: "deploy@project.iam.gserviceaccount.com",
+			path:           "/v1/projects/-/serviceAccounts/deploy@project.iam.gserviceaccount.com:generateAccessToken",
+			body:           `{"expireTime":"2030-01-01T00:00:00Z"}`,
+			err:            "server response missing accessToken or expireTime",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fakestore.New()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == tt.path {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(tt.body))
+					return
+				}
+				store.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+
+			ts, err := newFederatedTokenSource(context.Background(), newWorkloadIdentity(server, tt.serviceAccount), ChromeWebstoreScope)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := ts.Token(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the file, in the source folder, listing the paths left out of the package
+const IgnoreFile = ".webstoreignore"
+
+// ignoreRule is a pattern using the gitignore syntax
+type ignoreRule struct {
+	// origin describe where the pattern come from, eg: ".webstoreignore:3"
+	origin  string
+	pattern string
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// PathFilter decide which paths of the source folder are packaged
+type PathFilter struct {
+	ignore  []ignoreRule
+	include []ignoreRule
+}
+
+// NewPathFilter load the ignore file of the source folder, if any, then layer the exclude patterns on top of it.
+// When include patterns are given, only the files matching one of them are packaged.
+func NewPathFilter(source string, include, exclude []string) (*PathFilter, error) {
+	filter := &PathFilter{}
+
+	file, err := os.Open(filepath.Join(source, IgnoreFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to open %s: %v", IgnoreFile, err)
+	}
+	if err == nil {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			rule, ok, err := parseIgnoreRule(scanner.Text(), fmt.Sprintf("%s:%d", IgnoreFile, line))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				filter.ignore = append(filter.ignore, rule)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", IgnoreFile, err)
+		}
+	}
+
+	for _, pattern := range exclude {
+		rule, ok, err := parseIgnoreRule(pattern, "--exclude")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filter.ignore = append(filter.ignore, rule)
+		}
+	}
+
+	for _, pattern := range include {
+		rule, ok, err := parseIgnoreRule(pattern, "--include")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filter.include = append(filter.include, rule)
+		}
+	}
+
+	return filter, nil
+}
+
+// Skip return whether the path, relative to the source folder and slash separated, is left out of the package, and why.
+// A skipped directory is not walked, so the files it contains can not be included again.
+func (f *PathFilter) Skip(path string, isDir bool) (bool, string) {
+	if f == nil {
+		return false, ""
+	}
+
+	if path == IgnoreFile {
+		return true, "ignore file"
+	}
+
+	// The last matching rule win, a negated rule include again the path
+	var last *ignoreRule
+	for i := range f.ignore {
+		if f.ignore[i].match(path, isDir) {
+			last = &f.ignore[i]
+		}
+	}
+	if last != nil && !last.negate {
+		return true, fmt.Sprintf("%s: %s", last.origin, last.pattern)
+	}
+
+	if isDir || len(f.include) == 0 {
+		return false, ""
+	}
+
+	for _, rule := range f.include {
+		if !rule.negate && rule.matchFileOrParent(path) {
+			return false, ""
+		}
+	}
+
+	return true, "not matched by --include"
+}
+
+// matchFileOrParent return whether the rule match the file or one of its parent directories,
+// so a directory pattern include every file it contains
+func (r ignoreRule) matchFileOrParent(path string) bool {
+	if r.match(path, false) {
+		return true
+	}
+
+	for i := strings.LastIndexByte(path, '/'); i > 0; i = strings.LastIndexByte(path, '/') {
+		path = path[:i]
+		if r.match(path, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	return r.re.MatchString(path)
+}
+
+// parseIgnoreRule convert a gitignore pattern in a rule, ok is false for blank lines and comments
+func parseIgnoreRule(line, origin string) (rule ignoreRule, ok bool, err error) {
+	// Trailing spaces are ignored unless escaped
+	pattern := strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(pattern, "\\") && len(line) > len(pattern) {
+		pattern += " "
+	}
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return ignoreRule{}, false, nil
+	}
+
+	rule = ignoreRule{origin: origin, pattern: pattern}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\!") || strings.HasPrefix(pattern, "\\#") {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A pattern with a slash at the beginning or in the middle is relative to the source folder,
+	// otherwise it match at any depth
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return ignoreRule{}, false, nil
+	}
+
+	expr := globToRegexp(pattern)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	if rule.re, err = regexp.Compile("^" + expr + "$"); err != nil {
+		return ignoreRule{}, false, fmt.Errorf("invalid pattern %q in %s: %v", rule.pattern, origin, err)
+	}
+
+	return rule, true, nil
+}
+
+// globToRegexp translate a gitignore glob in a regular expression,
+// "*" and "?" do not match slashes while "**" match any number of directories
+func globToRegexp(pattern string) string {
+	var expr bytes.Buffer
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			// Zero or more directories
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern) && (i == 0 || pattern[i-1] == '/'):
+			// Everything inside
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, "\\", "\\\\", -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFilterSkip(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignore  string
+		include []string
+		exclude []string
+		// packaged and skipped are files, relative to the source folder
+		packaged []string
+		skipped  []string
+	}{
+		{
+			name:     "no rules",
+			packaged: []string{"manifest.json", "js/app.js"},
+			skipped:  []string{IgnoreFile},
+		},
+		{
+			name:     "ignore file",
+			ignore:   "*.map\n# comment\nnode_modules/\n!keep.map\n",
+			packaged: []string{"manifest.json", "js/app.js", "keep.map"},
+			skipped:  []string{"js/app.js.map", "node_modules/lib/index.js"},
+		},
+		{
+			name:     "exclude after ignore file",
+			ignore:   "!docs/\n",
+			exclude:  []string{"docs/"},
+			packaged: []string{"manifest.json"},
+			skipped:  []string{"docs/README.md"},
+		},
+		{
+			name:     "include directory",
+			include:  []string{"manifest.json", "js/"},
+			packaged: []string{"manifest.json", "js/app.js", "js/lib/util.js"},
+			skipped:  []string{"README.md", "src/js.ts"},
+		},
+		{
+			name:     "include bare name",
+			include:  []string{"manifest.json", "assets"},
+			packaged: []string{"assets", "assets/icon.png", "img/assets/logo.png"},
+			skipped:  []string{"assets.txt", "img/icon.png"},
+		},
+		{
+			name:     "include anchored directory",
+			include:  []string{"/manifest.json", "/js"},
+			packaged: []string{"manifest.json", "js/app.js"},
+			skipped:  []string{"src/js/app.js", "src/manifest.json"},
+		},
+		{
+			name:     "include glob",
+			include:  []string{"manifest.json", "*.js"},
+			packaged: []string{"manifest.json", "app.js", "js/lib/util.js"},
+			skipped:  []string{"style.css", "js/style.css"},
+		},
+		{
+			name:     "exclude has precedence on include",
+			include:  []string{"manifest.json", "js/"},
+			exclude:  []string{"*.test.js"},
+			packaged: []string{"manifest.json", "js/app.js"},
+			skipped:  []string{"js/app.test.js"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := ioutil.TempDir("", "drone-chromewebstore-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(source)
+
+			if tt.ignore != "" {
+				if err := ioutil.WriteFile(filepath.Join(source, IgnoreFile), []byte(tt.ignore), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			filter, err := NewPathFilter(source, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, path := range tt.packaged {
+				if skip, reason := skipFile(filter, path); skip {
+					t.Errorf("expected %s to be packaged, skipped by %s", path, reason)
+				}
+			}
+			for _, path := range tt.skipped {
+				if skip, _ := skipFile(filter, path); !skip {
+					t.Errorf("expected %s to be skipped", path)
+				}
+			}
+		})
+	}
+}
+
+// skipFile check the file and its parent directories as addAll does, a skipped directory is not walked
+func skipFile(filter *PathFilter, path string) (bool, string) {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			if skip, reason := filter.Skip(path[:i], true); skip {
+				return true, reason
+			}
+		}
+	}
+
+	return filter.Skip(path, false)
+}
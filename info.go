@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+var infoCommand = cli.Command{
+	Name:   "info",
+	Usage:  "Print the information of the application",
+	Action: info,
+	Flags: append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "projection",
+			Usage: "Version to describe, should be draft or published",
+			Value: "draft",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format, should be table or json",
+			Value: "table",
+		},
+	}, pluginFlags...),
+}
+
+func info(c *cli.Context) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return cli.NewExitError(fmt.Errorf("unsupported format %s", format), ExitCodeError)
+	}
+
+	plugin := newPlugin(c)
+
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+	plugin.Authentication.Scope = ChromeWebstoreReadOnlyScope
+
+	client, err := NewChromeWebstoreClient(ctx, plugin.ApplicationID, plugin.API, plugin.Authentication)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to create a chrome webstore client: %v", err), ExitCodeError)
+	}
+
+	item, err := client.GetInfo(ctx, strings.ToUpper(c.String("projection")))
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to get application info: %v", err), ExitCodeError)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(item); err != nil {
+			return cli.NewExitError(fmt.Errorf("unable to encode application info: %v", err), ExitCodeError)
+		}
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\n", item.ID)
+	fmt.Fprintf(w, "Version\t%s\n", item.CrxVersion)
+	fmt.Fprintf(w, "Upload state\t%s\n", item.UploadState)
+	fmt.Fprintf(w, "Public key\t%s\n", item.PublicKey)
+	for _, e := range item.ItemError {
+		fmt.Fprintf(w, "Error\t%s (%s)\n", e.ErrorDetail, e.ErrorCode)
+	}
+
+	return w.Flush()
+}
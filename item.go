@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Upload states returned by Chrome Webstore
+const (
+	UploadStateSuccess    = "SUCCESS"
+	UploadStateFailure    = "FAILURE"
+	UploadStateInProgress = "IN_PROGRESS"
+	UploadStateNotFound   = "NOT_FOUND"
+)
+
+// ItemError describe an error reported by Chrome Webstore for an item
+type ItemError struct {
+	ErrorCode   string `json:"error_code"`
+	ErrorDetail string `json:"error_detail"`
+}
+
+// UploadResult contains the response of Chrome Webstore to an upload request
+type UploadResult struct {
+	Kind        string      `json:"kind"`
+	ID          string      `json:"id"`
+	UploadState string      `json:"uploadState"`
+	ItemError   []ItemError `json:"itemError"`
+}
+
+// Err return an error if the upload has been refused by Chrome Webstore
+func (r UploadResult) Err() error {
+	if r.UploadState != UploadStateFailure && r.UploadState != UploadStateNotFound {
+		return nil
+	}
+
+	return fmt.Errorf("upload state is %s: %s", r.UploadState, formatItemErrors(r.ItemError))
+}
+
+// Projections of an item, DRAFT describe the last uploaded version, PUBLISHED the version available to users
+const (
+	ProjectionDraft     = "DRAFT"
+	ProjectionPublished = "PUBLISHED"
+)
+
+// Item contains the information of an application stored in Chrome Webstore
+type Item struct {
+	Kind        string      `json:"kind"`
+	ID          string      `json:"id"`
+	PublicKey   string      `json:"publicKey"`
+	UploadState string      `json:"uploadState"`
+	CrxVersion  string      `json:"crxVersion"`
+	ItemError   []ItemError `json:"itemError"`
+}
+
+// PublishOutcome classify the result of a publish request
+type PublishOutcome int
+
+// Publish outcomes
+const (
+	PublishOutcomePublished PublishOutcome = iota
+	PublishOutcomePendingReview
+	PublishOutcomeRejected
+	PublishOutcomeUnauthorized
+)
+
+// PublishResult contains the response of Chrome Webstore to a publish request
+type PublishResult struct {
+	Kind         string   `json:"kind"`
+	ItemID       string   `json:"item_id"`
+	Status       []string `json:"status"`
+	StatusDetail []string `json:"statusDetail"`
+	// DeployPercentage is the percentage of users receiving the version, when reported by the store
+	DeployPercentage *int `json:"-"`
+}
+
+// Outcome return the class of the publish result based on the returned status codes
+func (r PublishResult) Outcome() PublishOutcome {
+	outcome := PublishOutcomePublished
+
+	for _, status := range r.Status {
+		switch status {
+		case "OK":
+		case "ITEM_PENDING_REVIEW":
+			if outcome == PublishOutcomePublished {
+				outcome = PublishOutcomePendingReview
+			}
+		case "NOT_AUTHORIZED", "INVALID_DEVELOPER", "DEVELOPER_NO_OWNERSHIP", "DEVELOPER_SUSPENDED", "PUBLISHER_SUSPENDED":
+			return PublishOutcomeUnauthorized
+		default:
+			outcome = PublishOutcomeRejected
+		}
+	}
+
+	return outcome
+}
+
+// PublishError is returned when Chrome Webstore does not publish immediately the application
+type PublishError struct {
+	Result PublishResult
+}
+
+func (e PublishError) Error() string {
+	return fmt.Sprintf("publish status is %s: %s", strings.Join(e.Result.Status, ", "), strings.Join(e.Result.StatusDetail, ", "))
+}
+
+// validateDeployPercentage check the deploy percentage is in the 0-100 range
+func validateDeployPercentage(percentage int) error {
+	if percentage < 0 || percentage > 100 {
+		return fmt.Errorf("deploy percentage should be between 0 and 100, got %d", percentage)
+	}
+
+	return nil
+}
+
+func formatItemErrors(errs []ItemError) string {
+	if len(errs) == 0 {
+		return "no details provided"
+	}
+
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, fmt.Sprintf("%s (%s)", e.ErrorDetail, e.ErrorCode))
+	}
+
+	return strings.Join(messages, ", ")
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/oauth2"
+)
+
+// DefaultAuthURL is the Google OAuth consent endpoint
+const DefaultAuthURL = "https://accounts.google.com/o/oauth2/auth"
+
+var authCommand = cli.Command{
+	Name:  "auth",
+	Usage: "Manage credentials used to access Chrome Webstore",
+	Subcommands: []cli.Command{
+		{
+			Name:   "login",
+			Usage:  "Generate a refresh token by granting access in the browser",
+			Action: login,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "client-id",
+					Usage:  "Client ID",
+					EnvVar: "PLUGIN_CLIENT_ID",
+				},
+				cli.StringFlag{
+					Name:   "client-secret",
+					Usage:  "Client secret",
+					EnvVar: "PLUGIN_CLIENT_SECRET",
+				},
+				cli.StringFlag{
+					Name:   "auth-url",
+					Usage:  "OAuth consent endpoint URL",
+					EnvVar: "PLUGIN_AUTH_URL",
+					Value:  DefaultAuthURL,
+				},
+				cli.StringFlag{
+					Name:   "token-url",
+					Usage:  "OAuth token endpoint URL",
+					EnvVar: "PLUGIN_TOKEN_URL",
+					Value:  DefaultTokenURL,
+				},
+				cli.StringFlag{
+					Name:  "listen",
+					Usage: "Loopback address receiving the authorization code",
+					Value: "127.0.0.1:0",
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "Maximum time to grant the access and get the refresh token",
+					Value: 5 * time.Minute,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "Output format, should be env (env file read by --env-file) or token (refresh token only)",
+					Value: "env",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "File the credentials are written to, standard output if not set",
+				},
+			},
+		},
+	},
+}
+
+func login(c *cli.Context) error {
+	format := c.String("format")
+	if format != "env" && format != "token" {
+		return cli.NewExitError(fmt.Errorf("unsupported format %s", format), ExitCodeError)
+	}
+
+	if c.String("client-id") == "" || c.String("client-secret") == "" {
+		return cli.NewExitError("client ID and client secret are required", ExitCodeError)
+	}
+
+	listener, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to start loopback listener: %v", err), ExitCodeError)
+	}
+	defer listener.Close()
+
+	cfg := oauth2.Config{
+		ClientID:     c.String("client-id"),
+		ClientSecret: c.String("client-secret"),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.String("auth-url"),
+			TokenURL: c.String("token-url"),
+		},
+		RedirectURL: fmt.Sprintf("http://%s/", listener.Addr().String()),
+		Scopes: []string{
+			ChromeWebstoreScope,
+			// Allow verify and info to restrict their access token to read only
+			ChromeWebstoreReadOnlyScope,
+		},
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+
+	fmt.Fprintf(os.Stderr, "Open the following URL in your browser and grant access:\n\n%s\n\n", consentURL(cfg, state, verifier))
+
+	// The timeout bound the consent in the browser and the exchange of the code
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+
+	code, err := waitForCode(ctx, listener, state)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to get authorization code: %v", err), ExitCodeError)
+	}
+
+	refreshToken, err := exchangeCode(ctx, cfg, code, verifier)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to exchange authorization code: %v", err), ExitCodeError)
+	}
+
+	content := refreshToken + "\n"
+	if format == "env" {
+		content = fmt.Sprintf("PLUGIN_CLIENT_ID=%s\nPLUGIN_CLIENT_SECRET=%s\nPLUGIN_REFRESH_TOKEN=%s\n", cfg.ClientID, cfg.ClientSecret, refreshToken)
+	}
+
+	if c.String("output") == "" {
+		fmt.Print(content)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(c.String("output"), []byte(content), 0600); err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to write credentials: %v", err), ExitCodeError)
+	}
+	logrus.WithField("output", c.String("output")).Infoln("credentials saved")
+
+	return nil
+}
+
+// consentURL return the URL of the consent page, requesting an authorization code bound to the PKCE verifier
+func consentURL(cfg oauth2.Config, state, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+
+	return cfg.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// waitForCode serve the loopback redirect until the authorization code is received or ctx is done
+func waitForCode(ctx context.Context, listener net.Listener, state string) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("state") != state {
+				http.Error(w, "Invalid state", http.StatusBadRequest)
+				return
+			}
+
+			res := result{code: query.Get("code")}
+			if e := query.Get("error"); e != "" {
+				res.err = fmt.Errorf("access not granted: %s", e)
+			} else if res.code == "" {
+				res.err = fmt.Errorf("authorization code missing")
+			}
+
+			if res.err != nil {
+				http.Error(w, res.err.Error(), http.StatusBadRequest)
+			} else {
+				fmt.Fprintln(w, "Access granted, you can close this window.")
+			}
+
+			select {
+			case results <- res:
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	select {
+	case res := <-results:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("access not granted: %v", ctx.Err())
+	}
+}
+
+// exchangeCode exchange the authorization code with the PKCE verifier, returning the refresh token
+func exchangeCode(ctx context.Context, cfg oauth2.Config, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", cfg.ClientSecret)
+
+	req, err := http.NewRequest("POST", cfg.Endpoint.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := decodeResponse(res, &response); err != nil {
+		return "", err
+	}
+
+	if response.RefreshToken == "" {
+		return "", fmt.Errorf("no refresh token returned, revoke the existing grant and retry")
+	}
+
+	return response.RefreshToken, nil
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("unable to generate random value: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
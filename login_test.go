@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mavimo/drone-chromewebstore/fakestore"
+	"golang.org/x/oauth2"
+)
+
+// newLoginConfig return the OAuth configuration of a login against server, redirecting to listener
+func newLoginConfig(server *httptest.Server, listener net.Listener) oauth2.Config {
+	return oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/o/oauth2/auth",
+			TokenURL: server.URL + "/o/oauth2/token",
+		},
+		RedirectURL: "http://" + listener.Addr().String() + "/",
+		Scopes:      []string{ChromeWebstoreScope},
+	}
+}
+
+func TestLoginFakeStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// verifier is sent on exchange, instead of the one the code has been requested with
+		verifier string
+		err      bool
+	}{
+		{
+			name: "granted",
+		},
+		{
+			name:     "wrong verifier",
+			verifier: "another-verifier",
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(fakestore.New())
+			defer server.Close()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cfg := newLoginConfig(server, listener)
+			// The fake consent page redirect immediately to the loopback listener, as a browser would
+			go func() {
+				if res, err := http.Get(consentURL(cfg, "state", "verifier")); err == nil {
+					res.Body.Close()
+				}
+			}()
+
+			code, err := waitForCode(ctx, listener, "state")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			verifier := "verifier"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			refreshToken, err := exchangeCode(ctx, cfg, code, verifier)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got refresh token %q", refreshToken)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if refreshToken != fakestore.RefreshToken {
+				t.Errorf("expected refresh token %q, got %q", fakestore.RefreshToken, refreshToken)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := exchangeCode(ctx, newLoginConfig(server, listener), "code", "verifier"); err == nil {
+		t.Fatal("expected an error when the token endpoint does not answer")
+	}
+}
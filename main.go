@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/joho/godotenv/autoload"
@@ -9,12 +15,243 @@ import (
 	"github.com/urfave/cli"
 )
 
+// Exit codes returned when publish is not completed
+const (
+	ExitCodeError         = 1
+	ExitCodePendingReview = 2
+	ExitCodeRejected      = 3
+	ExitCodeUnauthorized  = 4
+)
+
 // Version set at compile-time
 var (
 	Version  string
 	BuildNum string
 )
 
+// pluginFlags contains the settings shared by the plugin and the commands acting on an application
+var pluginFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "env-file",
+		Usage: "Env file to load (useful for debugging)",
+	},
+	cli.StringFlag{
+		Name:   "application",
+		Usage:  "Application ID",
+		EnvVar: "PLUGIN_APPLICATION",
+	},
+	cli.StringFlag{
+		Name:   "applications",
+		Usage:  "JSON list of applications to deploy, each one with id, source and optional credentials",
+		EnvVar: "PLUGIN_APPLICATIONS",
+	},
+	cli.StringSliceFlag{
+		Name:   "app",
+		Usage:  "Application to deploy as ID=SOURCE, can be repeated",
+		EnvVar: "PLUGIN_APPS",
+	},
+	cli.IntFlag{
+		Name:   "concurrency",
+		Usage:  "Maximum number of applications deployed at the same time",
+		EnvVar: "PLUGIN_CONCURRENCY",
+		Value:  DefaultConcurrency,
+	},
+	cli.StringFlag{
+		Name:   "client-id",
+		Usage:  "Client ID",
+		EnvVar: "PLUGIN_CLIENT_ID",
+	},
+	cli.StringFlag{
+		Name:   "client-secret",
+		Usage:  "Client secret",
+		EnvVar: "PLUGIN_CLIENT_SECRET",
+	},
+	cli.StringFlag{
+		Name:   "refresh-token",
+		Usage:  "Refresh token",
+		EnvVar: "PLUGIN_REFRESH_TOKEN",
+	},
+	cli.StringFlag{
+		Name:   "service-account-key",
+		Usage:  "Service account JSON key, as file path or content",
+		EnvVar: "PLUGIN_SERVICE_ACCOUNT_KEY",
+	},
+	cli.StringFlag{
+		Name:   "oidc-token",
+		Usage:  "OIDC ID token issued by the CI, used with workload identity federation",
+		EnvVar: "PLUGIN_OIDC_TOKEN",
+	},
+	cli.StringFlag{
+		Name:   "oidc-token-file",
+		Usage:  "File containing the OIDC ID token issued by the CI",
+		EnvVar: "PLUGIN_OIDC_TOKEN_FILE",
+	},
+	cli.StringFlag{
+		Name:   "workload-identity-provider",
+		Usage:  "Full resource name of the workload identity provider",
+		EnvVar: "PLUGIN_WORKLOAD_IDENTITY_PROVIDER",
+	},
+	cli.StringFlag{
+		Name:   "service-account",
+		Usage:  "Email of the service account to impersonate with the federated token",
+		EnvVar: "PLUGIN_SERVICE_ACCOUNT",
+	},
+	cli.StringFlag{
+		Name:   "sts-url",
+		Usage:  "Security token service URL used to exchange the OIDC token",
+		EnvVar: "PLUGIN_STS_URL",
+		Value:  DefaultSTSURL,
+	},
+	cli.StringFlag{
+		Name:   "impersonation-url",
+		Usage:  "IAM credentials API base URL used to impersonate the service account",
+		EnvVar: "PLUGIN_IMPERSONATION_URL",
+		Value:  DefaultImpersonationURL,
+	},
+	cli.StringFlag{
+		Name:   "publisher-id",
+		Usage:  "Publisher ID, required by API v2",
+		EnvVar: "PLUGIN_PUBLISHER_ID",
+	},
+	cli.StringFlag{
+		Name:   "api-version",
+		Usage:  "Chrome Webstore API version, should be v1.1 or v2",
+		EnvVar: "PLUGIN_API_VERSION",
+		Value:  APIVersion1,
+	},
+	cli.StringFlag{
+		Name:   "api-base-url",
+		Usage:  "Chrome Webstore API base URL (default depends on API version)",
+		EnvVar: "PLUGIN_API_BASE_URL",
+	},
+	cli.StringFlag{
+		Name:   "token-url",
+		Usage:  "OAuth token endpoint URL (default to Google token endpoint)",
+		EnvVar: "PLUGIN_TOKEN_URL",
+	},
+	cli.IntFlag{
+		Name:   "retry-max-attempts",
+		Usage:  "Maximum number of attempts for requests failing with transient errors",
+		EnvVar: "PLUGIN_RETRY_MAX_ATTEMPTS",
+		Value:  5,
+	},
+	cli.DurationFlag{
+		Name:   "retry-base-delay",
+		Usage:  "Base delay of the exponential backoff between attempts",
+		EnvVar: "PLUGIN_RETRY_BASE_DELAY",
+		Value:  time.Second,
+	},
+	cli.DurationFlag{
+		Name:   "retry-max-delay",
+		Usage:  "Maximum delay between attempts",
+		EnvVar: "PLUGIN_RETRY_MAX_DELAY",
+		Value:  30 * time.Second,
+	},
+	cli.StringFlag{
+		Name:   "upload-mode",
+		Usage:  "Upload the package in resumable chunks (resumable) or in a single request (simple)",
+		EnvVar: "PLUGIN_UPLOAD_MODE",
+		Value:  UploadModeSimple,
+	},
+	cli.IntFlag{
+		Name:   "upload-chunk-size",
+		Usage:  "Size in MiB of the chunks sent by resumable uploads",
+		EnvVar: "PLUGIN_UPLOAD_CHUNK_SIZE",
+		Value:  DefaultUploadChunkSize >> 20,
+	},
+	cli.DurationFlag{
+		Name:   "timeout",
+		Usage:  "Maximum duration of the whole operation (no limit by default)",
+		EnvVar: "PLUGIN_TIMEOUT",
+	},
+	cli.DurationFlag{
+		Name:   "token-timeout",
+		Usage:  "Maximum time to get an access token",
+		EnvVar: "PLUGIN_TOKEN_TIMEOUT",
+		Value:  time.Minute,
+	},
+	cli.DurationFlag{
+		Name:   "upload-timeout",
+		Usage:  "Maximum time to upload the application, including the wait of its processing",
+		EnvVar: "PLUGIN_UPLOAD_TIMEOUT",
+		Value:  30 * time.Minute,
+	},
+	cli.DurationFlag{
+		Name:   "publish-timeout",
+		Usage:  "Maximum time to publish the application",
+		EnvVar: "PLUGIN_PUBLISH_TIMEOUT",
+		Value:  5 * time.Minute,
+	},
+	cli.StringFlag{
+		Name:   "source",
+		Usage:  "Application source folder",
+		EnvVar: "PLUGIN_SOURCE",
+	},
+	cli.StringSliceFlag{
+		Name:   "include",
+		Usage:  "Package only the files matching the pattern, or contained in a directory matching it, can be repeated",
+		EnvVar: "PLUGIN_INCLUDE",
+	},
+	cli.StringSliceFlag{
+		Name:   "exclude",
+		Usage:  "Leave the paths matching the pattern out of the package, can be repeated",
+		EnvVar: "PLUGIN_EXCLUDE",
+	},
+	cli.StringFlag{
+		Name:   "package",
+		Usage:  "Prebuilt .zip or .crx uploaded instead of the source folder",
+		EnvVar: "PLUGIN_PACKAGE",
+	},
+	cli.StringFlag{
+		Name:   "output",
+		Usage:  "Path where the generated package is written, a directory when several applications are deployed",
+		EnvVar: "PLUGIN_OUTPUT",
+	},
+	cli.StringFlag{
+		Name:   "checksum-file",
+		Usage:  "File receiving the SHA-256 of the generated package",
+		EnvVar: "PLUGIN_CHECKSUM_FILE",
+	},
+	cli.BoolFlag{
+		Name:   "debug",
+		Usage:  "Enable debug logs",
+		EnvVar: "PLUGIN_DEBUG",
+	},
+	cli.BoolTFlag{
+		Name:   "upload",
+		Usage:  "Upload application to webstore",
+		EnvVar: "PLUGIN_UPLOAD",
+	},
+	cli.BoolTFlag{
+		Name:   "publish",
+		Usage:  "Pubplish application in webstore",
+		EnvVar: "PLUGIN_PUBLISH",
+	},
+	cli.StringFlag{
+		Name:   "publish-target",
+		Usage:  "Publish target, should be default or trustedTesters",
+		EnvVar: "PLUGIN_PUBLISH_TARGET",
+		Value:  "default",
+	},
+	cli.IntFlag{
+		Name:   "deploy-percentage",
+		Usage:  "Percentage of users receiving the published version (all users if not set)",
+		EnvVar: "PLUGIN_DEPLOY_PERCENTAGE",
+	},
+	cli.DurationFlag{
+		Name:   "poll-interval",
+		Usage:  "Interval between checks of an upload still in progress",
+		EnvVar: "PLUGIN_POLL_INTERVAL",
+		Value:  DefaultPollInterval,
+	},
+	cli.DurationFlag{
+		Name:   "poll-timeout",
+		Usage:  "Maximum time to wait for an upload still in progress",
+		EnvVar: "PLUGIN_POLL_TIMEOUT",
+		Value:  DefaultPollTimeout,
+	},
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "Drone Chrome Webstore"
@@ -27,53 +264,16 @@ func main() {
 		},
 	}
 	app.Action = run
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:  "env-file",
-			Usage: "Env file to load (useful for debugging)",
-		},
-		cli.StringFlag{
-			Name:   "application",
-			Usage:  "Application ID",
-			EnvVar: "PLUGIN_APPLICATION",
-		},
-		cli.StringFlag{
-			Name:   "client-id",
-			Usage:  "Client ID",
-			EnvVar: "PLUGIN_CLIENT_ID",
-		},
-		cli.StringFlag{
-			Name:   "client-secret",
-			Usage:  "Client secret",
-			EnvVar: "PLUGIN_CLIENT_SECRET",
-		},
-		cli.StringFlag{
-			Name:   "refresh-token",
-			Usage:  "Refresh token",
-			EnvVar: "PLUGIN_REFRESH_TOKEN",
-		},
-		cli.StringFlag{
-			Name:   "source",
-			Usage:  "Application source folder",
-			EnvVar: "PLUGIN_SOURCE",
-		},
-		cli.BoolTFlag{
-			Name:   "upload",
-			Usage:  "Upload application to webstore",
-			EnvVar: "PLUGIN_UPLOAD",
-		},
-		cli.BoolTFlag{
-			Name:   "publish",
-			Usage:  "Pubplish application in webstore",
-			EnvVar: "PLUGIN_PUBLISH",
-		},
-		cli.StringFlag{
-			Name:   "publish-target",
-			Usage:  "Publish target, should be default or trustedTesters",
-			EnvVar: "PLUGIN_PUBLISH_TARGET",
-			Value:  "default",
-		},
+	app.Commands = []cli.Command{
+		authCommand,
+		cancelCommand,
+		infoCommand,
+		packageCommand,
+		verifyCommand,
+		rolloutCommand,
+		serveFakeCommand,
 	}
+	app.Flags = pluginFlags
 
 	app.Version = Version
 
@@ -81,35 +281,189 @@ func main() {
 		app.Version = app.Version + "+" + BuildNum
 	}
 
+	if err := loadEnvFile(os.Args[1:]); err != nil {
+		logrus.Errorln(err)
+		os.Exit(ExitCodeError)
+	}
+
 	err := app.Run(os.Args)
 	if err != nil {
 		logrus.Warningln(err)
 	}
 }
 
+// loadEnvFile load the file given with --env-file, before the flags are parsed so its variables
+// are used as the default value of the flags
+func loadEnvFile(args []string) error {
+	for i, arg := range args {
+		if arg == "--" {
+			return nil
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if len(name) == len(arg) {
+			continue
+		}
+
+		var file string
+		switch {
+		case name == "env-file" && i+1 < len(args):
+			file = args[i+1]
+		case strings.HasPrefix(name, "env-file="):
+			file = strings.TrimPrefix(name, "env-file=")
+		default:
+			continue
+		}
+
+		if err := godotenv.Load(file); err != nil {
+			return fmt.Errorf("unable to load env file %s: %v", file, err)
+		}
+	}
+
+	return nil
+}
+
 func run(c *cli.Context) error {
-	if c.String("env-file") != "" {
-		_ = godotenv.Load(c.String("env-file"))
+	plugin, err := newApplicationsPlugin(c)
+	if err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+
+	return execPlugin(c, plugin)
+}
+
+// execPlugin run the plugin, it is interrupted by SIGINT, SIGTERM and the global timeout
+func execPlugin(c *cli.Context, plugin Plugin) error {
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+
+	if err := plugin.Exec(ctx); err != nil {
+		return cli.NewExitError(err, exitCode(err))
+	}
+
+	return nil
+}
+
+// newContext return a context cancelled when SIGINT or SIGTERM is received, or when timeout expires
+func newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := withTimeout(context.Background(), timeout)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			logrus.Warningf("received %s, cancelling operations in progress", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// newPlugin build the plugin from the flags of the command line
+func newPlugin(c *cli.Context) Plugin {
+	if c.Bool("debug") {
+		logrus.SetLevel(logrus.DebugLevel)
 	}
 
 	plugin := Plugin{
 		ApplicationID: c.String("application"),
+		API: API{
+			Version:     c.String("api-version"),
+			PublisherID: c.String("publisher-id"),
+			BaseURL:     c.String("api-base-url"),
+			Retry: RetryPolicy{
+				MaxAttempts: c.Int("retry-max-attempts"),
+				BaseDelay:   c.Duration("retry-base-delay"),
+				MaxDelay:    c.Duration("retry-max-delay"),
+			},
+			UploadMode:      c.String("upload-mode"),
+			UploadChunkSize: int64(c.Int("upload-chunk-size")) << 20,
+		},
 		Authentication: Authentication{
 			ClientID:     c.String("client-id"),
 			ClientSecret: c.String("client-secret"),
 			RefreshToken: c.String("refresh-token"),
+			TokenURL:     c.String("token-url"),
+			Timeout:      c.Duration("token-timeout"),
+
+			ServiceAccountKey: c.String("service-account-key"),
+			WorkloadIdentity: WorkloadIdentity{
+				Provider:         c.String("workload-identity-provider"),
+				OIDCToken:        c.String("oidc-token"),
+				OIDCTokenFile:    c.String("oidc-token-file"),
+				ServiceAccount:   c.String("service-account"),
+				STSURL:           c.String("sts-url"),
+				ImpersonationURL: c.String("impersonation-url"),
+			},
 		},
 		Config: Config{
 			Source:        c.String("source"),
+			Include:       c.StringSlice("include"),
+			Exclude:       c.StringSlice("exclude"),
 			Upload:        c.BoolT("upload"),
 			Publish:       c.BoolT("publish"),
 			PublishTarget: c.String("publish-target"),
+			PollInterval:  c.Duration("poll-interval"),
+			PollTimeout:   c.Duration("poll-timeout"),
+
+			UploadTimeout:  c.Duration("upload-timeout"),
+			PublishTimeout: c.Duration("publish-timeout"),
+			Concurrency:    c.Int("concurrency"),
+			ChecksumFile:   c.String("checksum-file"),
+			Output:         c.String("output"),
+			Package:        c.String("package"),
 		},
 	}
 
-	if err := plugin.Exec(); err != nil {
-		return cli.NewExitError(err, 1)
+	if c.IsSet("deploy-percentage") {
+		percentage := c.Int("deploy-percentage")
+		plugin.Config.DeployPercentage = &percentage
 	}
 
-	return nil
+	return plugin
+}
+
+// newApplicationsPlugin build the plugin from the flags of the command line, including the list of applications
+func newApplicationsPlugin(c *cli.Context) (Plugin, error) {
+	plugin := newPlugin(c)
+
+	applications, err := ParseApplications(c.String("applications"), c.StringSlice("app"))
+	if err != nil {
+		return Plugin{}, err
+	}
+	plugin.Applications = applications
+
+	return plugin, nil
+}
+
+func exitCode(err error) int {
+	if aerr, ok := err.(ApplicationsError); ok {
+		return aerr.exitCode()
+	}
+
+	if _, ok := err.(UnauthorizedError); ok {
+		return ExitCodeUnauthorized
+	}
+
+	perr, ok := err.(PublishError)
+	if !ok {
+		return ExitCodeError
+	}
+
+	switch perr.Result.Outcome() {
+	case PublishOutcomePendingReview:
+		return ExitCodePendingReview
+	case PublishOutcomeRejected:
+		return ExitCodeRejected
+	case PublishOutcomeUnauthorized:
+		return ExitCodeUnauthorized
+	}
+
+	return ExitCodeError
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+var packageCommand = cli.Command{
+	Name:   "package",
+	Usage:  "Write the package of the application to the output path, without uploading it",
+	Action: packageApplication,
+	Flags:  pluginFlags,
+}
+
+func packageApplication(c *cli.Context) error {
+	plugin, err := newApplicationsPlugin(c)
+	if err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+
+	if plugin.Config.Output == "" {
+		return cli.NewExitError(fmt.Errorf("output is required to package the application"), ExitCodeError)
+	}
+
+	// Packaging does not reach the store, so no credentials are needed
+	plugin.Config.Upload = false
+	plugin.Config.Publish = false
+
+	return execPlugin(c, plugin)
+}
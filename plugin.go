@@ -1,14 +1,41 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 // Plugin to deploy application in chrome webstore
 type Plugin struct {
 	ApplicationID  string
+	API            API
 	Config         Config
 	Authentication Authentication
+	// Client is used to reach Chrome Webstore, when nil a ChromeWebstoreClient is created from API and Authentication.
+	// It is ignored when Applications are deployed, since a client manage a single application.
+	Client WebstoreAPI
+	// Applications to deploy instead of ApplicationID, each one with its own client
+	Applications []Application
+}
+
+// API contains settings used to reach Chrome Webstore API
+type API struct {
+	Version     string
+	PublisherID string
+	BaseURL     string
+	Retry       RetryPolicy
+	// UploadMode is UploadModeSimple (default) or UploadModeResumable
+	UploadMode string
+	// UploadChunkSize is the size in bytes of the chunks sent by resumable uploads
+	UploadChunkSize int64
 }
 
 // Authentication contains settings required to authenticate API
@@ -16,6 +43,14 @@ type Authentication struct {
 	ClientID     string
 	ClientSecret string
 	RefreshToken string
+	TokenURL     string
+	// ServiceAccountKey is the path of a service account JSON key, or its content
+	ServiceAccountKey string
+	WorkloadIdentity  WorkloadIdentity
+	// Scope requested for the access token, default to ChromeWebstoreScope
+	Scope string
+	// Timeout limit the time spent to get an access token
+	Timeout time.Duration
 }
 
 // Config indication operation to do in plugin
@@ -24,31 +59,268 @@ type Config struct {
 	Upload        bool
 	Publish       bool
 	PublishTarget string
+	// PollInterval and PollTimeout control the wait of uploads in progress, zero use DefaultPollInterval and DefaultPollTimeout
+	PollInterval time.Duration
+	PollTimeout  time.Duration
+	// DeployPercentage limit the publish to a percentage of users, nil publish to all users
+	DeployPercentage *int
+	UploadTimeout    time.Duration
+	PublishTimeout   time.Duration
+	// Concurrency is the maximum number of Applications deployed at the same time
+	Concurrency int
+	// Include and Exclude are gitignore patterns layered on top of the ignore file of Source
+	Include []string
+	Exclude []string
+	// ChecksumFile receive the SHA-256 of the generated packages, in the sha256sum format
+	ChecksumFile string
+	// Output is the path where the generated package is written
+	Output string
+	// Package is a prebuilt .zip or .crx uploaded instead of the content of Source
+	Package string
 }
 
-// Exec operation for this plugin
-func (p Plugin) Exec() error {
-	client, err := NewChromeWebstoreClient(p.ApplicationID, p.Authentication)
-	if err != nil {
-		return fmt.Errorf("unable to create a chrome webstore client: %v", err)
+// Exec operation for this plugin, ctx cancellation interrupt the operation in progress
+func (p Plugin) Exec(ctx context.Context) error {
+	if len(p.Applications) > 0 {
+		return p.execApplications(ctx)
 	}
 
-	if p.Config.Upload {
-		buf, err := GenerateZipContent(p.Config.Source)
-		if err != nil {
-			return fmt.Errorf("unable to generate zip content: %v", err)
+	checksum, err := p.deploy(ctx)
+	if checksum != "" && p.Config.ChecksumFile != "" {
+		if err := writeChecksumFile(p.Config.ChecksumFile, []packageChecksum{{p.packageName(), checksum}}); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// deploy package, upload and publish the application, it return the SHA-256 of the package when it has been generated or loaded.
+// The store is not reached when neither upload nor publish are requested.
+func (p Plugin) deploy(ctx context.Context) (string, error) {
+	if p.Config.Publish && p.Config.DeployPercentage != nil {
+		if err := validateDeployPercentage(*p.Config.DeployPercentage); err != nil {
+			return "", err
+		}
+	}
+
+	// The package is ready before reaching the store, so an invalid package does not need credentials
+	var pkg io.ReadSeeker
+	var checksum string
+	if p.Config.Upload || p.Config.Output != "" {
+		var release func()
+		var err error
+		if pkg, checksum, release, err = p.openPackage(); err != nil {
+			return "", err
+		}
+		defer release()
+	}
+
+	var client WebstoreAPI
+	if p.Config.Upload || p.Config.Publish {
+		var err error
+		if client, err = p.client(ctx); err != nil {
+			// The token phase is reported by the client, which use its own timeout
+			return checksum, authorizationError(err, fmt.Errorf("unable to create a chrome webstore client: %v", err))
+		}
+	}
+
+	if pkg != nil {
+		if p.Config.Output != "" {
+			if err := writePackage(pkg, p.Config.Output); err != nil {
+				return checksum, err
+			}
 		}
 
-		if err := client.UploadNewVersion(buf); err != nil {
-			return fmt.Errorf("unable to upload a new version: %v", err)
+		if p.Config.Upload {
+			if err := p.upload(ctx, client, pkg); err != nil {
+				return checksum, err
+			}
 		}
 	}
 
 	if p.Config.Publish {
-		if err := client.PublishVersion(p.Config.PublishTarget); err != nil {
-			return fmt.Errorf("unable to publish a new version: %v", err)
+		if err := p.publish(ctx, client); err != nil {
+			return checksum, err
+		}
+	}
+
+	return checksum, nil
+}
+
+// client return the injected client, or create one from the plugin settings
+func (p Plugin) client(ctx context.Context) (WebstoreAPI, error) {
+	if p.Client != nil {
+		return p.Client, nil
+	}
+
+	return NewChromeWebstoreClient(ctx, p.ApplicationID, p.API, p.Authentication)
+}
+
+func (p Plugin) upload(ctx context.Context, client WebstoreAPI, pkg io.ReadSeeker) error {
+	ctx, cancel := withTimeout(ctx, p.Config.UploadTimeout)
+	defer cancel()
+
+	result, err := client.UploadNewVersion(ctx, pkg)
+	if err != nil {
+		return authorizationError(err, phaseError(ctx, "upload", fmt.Errorf("unable to upload a new version: %v", err)))
+	}
+
+	if result.UploadState == UploadStateInProgress {
+		if _, err := client.WaitForUpload(ctx, p.Config.PollInterval, p.Config.PollTimeout); err != nil {
+			return authorizationError(err, phaseError(ctx, "upload", fmt.Errorf("unable to complete upload of the new version: %v", err)))
+		}
+	}
+
+	return nil
+}
+
+func (p Plugin) publish(ctx context.Context, client WebstoreAPI) error {
+	ctx, cancel := withTimeout(ctx, p.Config.PublishTimeout)
+	defer cancel()
+
+	if _, err := client.PublishVersion(ctx, p.Config.PublishTarget, p.Config.DeployPercentage); err != nil {
+		if perr, ok := err.(PublishError); ok {
+			return perr
+		}
+
+		return authorizationError(err, phaseError(ctx, "publish", fmt.Errorf("unable to publish a new version: %v", err)))
+	}
+
+	return nil
+}
+
+// openPackage return the package to upload and its SHA-256, read from the prebuilt Package or generated from Source.
+// release must be called once the package is no more used.
+func (p Plugin) openPackage() (pkg io.ReadSeeker, checksum string, release func(), err error) {
+	if p.Config.Package != "" {
+		prebuilt, err := OpenPackage(p.Config.Package)
+		if err != nil {
+			return nil, "", nil, err
 		}
+
+		logrus.WithFields(logrus.Fields{
+			"application": p.ApplicationID,
+			"package":     p.Config.Package,
+			"sha256":      prebuilt.SHA256,
+		}).Infoln("package loaded")
+
+		return prebuilt, prebuilt.SHA256, func() { prebuilt.Close() }, nil
+	}
+
+	filter, err := NewPathFilter(p.Config.Source, p.Config.Include, p.Config.Exclude)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	generated, checksum, err := GenerateZipFile(p.Config.Source, filter)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to generate zip content: %v", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"application": p.ApplicationID,
+		"sha256":      checksum,
+	}).Infoln("package generated")
+
+	return generated, checksum, func() { removeFile(generated) }, nil
+}
+
+// packageName return the file name of the package, used in the checksum file
+func (p Plugin) packageName() string {
+	if p.Config.Output != "" {
+		return filepath.Base(p.Config.Output)
+	}
+
+	return p.ApplicationID + ".zip"
+}
+
+// writePackage copy the package to path, creating its parent directories.
+// The package is written in a temporary file renamed once completed, so path can be the package itself.
+func writePackage(pkg io.ReadSeeker, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create output directory: %v", err)
+	}
+
+	output, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("unable to create output file: %v", err)
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	if _, err := pkg.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to rewind package: %v", err)
+	}
+	if _, err := io.Copy(output, pkg); err != nil {
+		return fmt.Errorf("unable to write package to %s: %v", path, err)
+	}
+	if err := output.Chmod(0644); err != nil {
+		return fmt.Errorf("unable to write package to %s: %v", path, err)
+	}
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("unable to write package to %s: %v", path, err)
+	}
+	if err := os.Rename(output.Name(), path); err != nil {
+		return fmt.Errorf("unable to write package to %s: %v", path, err)
+	}
+
+	logrus.WithField("output", path).Infoln("package written")
+
+	return nil
+}
+
+// packageChecksum is the SHA-256 of a package
+type packageChecksum struct {
+	Name   string
+	SHA256 string
+}
+
+// writeChecksumFile write a line for each package, in the format used by sha256sum
+func writeChecksumFile(path string, checksums []packageChecksum) error {
+	var content bytes.Buffer
+	for _, checksum := range checksums {
+		fmt.Fprintf(&content, "%s  %s\n", checksum.SHA256, checksum.Name)
+	}
+
+	if err := ioutil.WriteFile(path, content.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write checksum file: %v", err)
 	}
 
 	return nil
 }
+
+// withTimeout return a context expiring after timeout, a zero timeout never expire
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// phaseError report the interrupted phase when the error has been caused by the context
+func phaseError(ctx context.Context, phase string, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return fmt.Errorf("%s phase interrupted: %v", phase, err)
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%s phase timed out: %v", phase, err)
+	}
+
+	return err
+}
+
+// authorizationError report err as an UnauthorizedError when its cause is a refusal of the credentials
+func authorizationError(cause, err error) error {
+	switch cause := cause.(type) {
+	case UnauthorizedError:
+		return UnauthorizedError{err}
+	case APIError:
+		if cause.Unauthorized() {
+			return UnauthorizedError{err}
+		}
+	}
+
+	return err
+}
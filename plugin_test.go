@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWebstore is a WebstoreAPI returning scripted results, and recording the operations called
+type fakeWebstore struct {
+	uploadResult  UploadResult
+	uploadErr     error
+	waitErr       error
+	publishResult PublishResult
+	publishErr    error
+
+	calls    []string
+	uploaded []byte
+}
+
+func (f *fakeWebstore) UploadNewVersion(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error) {
+	f.calls = append(f.calls, "upload")
+	// As the client, the package is read from its beginning
+	if _, err := pkg.Seek(0, io.SeekStart); err != nil {
+		return UploadResult{}, err
+	}
+	f.uploaded, _ = ioutil.ReadAll(pkg)
+
+	return f.uploadResult, f.uploadErr
+}
+
+func (f *fakeWebstore) GetInfo(ctx context.Context, projection string) (Item, error) {
+	f.calls = append(f.calls, "info")
+
+	return Item{}, nil
+}
+
+func (f *fakeWebstore) WaitForUpload(ctx context.Context, interval, timeout time.Duration) (Item, error) {
+	f.calls = append(f.calls, "wait")
+
+	return Item{}, f.waitErr
+}
+
+func (f *fakeWebstore) PublishVersion(ctx context.Context, target string, deployPercentage *int) (PublishResult, error) {
+	f.calls = append(f.calls, "publish")
+
+	return f.publishResult, f.publishErr
+}
+
+func TestExec(t *testing.T) {
+	success := UploadResult{ID: "app1", UploadState: UploadStateSuccess}
+	published := PublishResult{ItemID: "app1", Status: []string{"OK"}}
+	publishError := func(status string) error {
+		return PublishError{PublishResult{ItemID: "app1", Status: []string{status}}}
+	}
+	forbidden := APIError{http.StatusForbidden, "403 Forbidden", `{"error":{"status":"PERMISSION_DENIED"}}`}
+
+	tests := []struct {
+		name    string
+		upload  bool
+		publish bool
+		store   fakeWebstore
+		// tokenRefused replace the fake store by a client whose token is refused
+		tokenRefused bool
+		calls        []string
+		// exitCode is the exit code of the error returned, 0 when no error is expected
+		exitCode int
+	}{
+		{
+			name: "nothing to do",
+		},
+		{
+			name:   "upload only",
+			upload: true,
+			store:  fakeWebstore{uploadResult: success},
+			calls:  []string{"upload"},
+		},
+		{
+			name:    "publish only",
+			publish: true,
+			store:   fakeWebstore{publishResult: published},
+			calls:   []string{"publish"},
+		},
+		{
+			name:    "upload and publish",
+			upload:  true,
+			publish: true,
+			store:   fakeWebstore{uploadResult: success, publishResult: published},
+			calls:   []string{"upload", "publish"},
+		},
+		{
+			name:     "upload error",
+			upload:   true,
+			publish:  true,
+			store:    fakeWebstore{uploadErr: errors.New("connection reset")},
+			calls:    []string{"upload"},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:     "upload unauthorized",
+			upload:   true,
+			publish:  true,
+			store:    fakeWebstore{uploadErr: APIError{http.StatusUnauthorized, "401 Unauthorized", `{"error":{"status":"UNAUTHENTICATED"}}`}},
+			calls:    []string{"upload"},
+			exitCode: ExitCodeUnauthorized,
+		},
+		{
+			name:    "upload refused",
+			upload:  true,
+			publish: true,
+			store: fakeWebstore{
+				uploadResult: UploadResult{UploadState: UploadStateFailure},
+				uploadErr:    errors.New("upload of application app1 refused"),
+			},
+			calls:    []string{"upload"},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:    "upload in progress completed",
+			upload:  true,
+			publish: true,
+			store: fakeWebstore{
+				uploadResult:  UploadResult{UploadState: UploadStateInProgress},
+				publishResult: published,
+			},
+			calls: []string{"upload", "wait", "publish"},
+		},
+		{
+			name:    "upload in progress failed",
+			upload:  true,
+			publish: true,
+			store: fakeWebstore{
+				uploadResult: UploadResult{UploadState: UploadStateInProgress},
+				waitErr:      errors.New("upload state is FAILURE"),
+			},
+			calls:    []string{"upload", "wait"},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:     "publish error",
+			publish:  true,
+			store:    fakeWebstore{publishErr: errors.New("connection reset")},
+			calls:    []string{"publish"},
+			exitCode: ExitCodeError,
+		},
+		{
+			name:     "publish forbidden",
+			publish:  true,
+			store:    fakeWebstore{publishErr: forbidden},
+			calls:    []string{"publish"},
+			exitCode: ExitCodeUnauthorized,
+		},
+		{
+			name:     "upload in progress forbidden",
+			upload:   true,
+			publish:  true,
+			store:    fakeWebstore{uploadResult: UploadResult{UploadState: UploadStateInProgress}, waitErr: forbidden},
+			calls:    []string{"upload", "wait"},
+			exitCode: ExitCodeUnauthorized,
+		},
+		{
+			name:         "token refused",
+			upload:       true,
+			publish:      true,
+			tokenRefused: true,
+			exitCode:     ExitCodeUnauthorized,
+		},
+		{
+			name:     "publish pending review",
+			publish:  true,
+			store:    fakeWebstore{publishErr: publishError("ITEM_PENDING_REVIEW")},
+			calls:    []string{"publish"},
+			exitCode: ExitCodePendingReview,
+		},
+		{
+			name:     "publish rejected",
+			publish:  true,
+			store:    fakeWebstore{publishErr: publishError("ITEM_NOT_UPDATABLE")},
+			calls:    []string{"publish"},
+			exitCode: ExitCodeRejected,
+		},
+		{
+			name:     "publish unauthorized",
+			publish:  true,
+			store:    fakeWebstore{publishErr: publishError("NOT_AUTHORIZED")},
+			calls:    []string{"publish"},
+			exitCode: ExitCodeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newSource(t, "1.0.0")
+			defer os.RemoveAll(source)
+
+			store := tt.store
+			p := Plugin{
+				ApplicationID: "app1",
+				Client:        &store,
+				Config: Config{
+					Source:        source,
+					Upload:        tt.upload,
+					Publish:       tt.publish,
+					PublishTarget: "default",
+				},
+			}
+
+			if tt.tokenRefused {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				}))
+				defer server.Close()
+
+				p.Client = nil
+				p.API.BaseURL = server.URL
+				p.Authentication = Authentication{ClientID: "client", ClientSecret: "secret", RefreshToken: "revoked", TokenURL: server.URL}
+			}
+
+			err := p.Exec(context.Background())
+			switch {
+			case tt.exitCode == 0 && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.exitCode != 0 && err == nil:
+				t.Fatalf("expected exit code %d, got no error", tt.exitCode)
+			case tt.exitCode != 0 && exitCode(err) != tt.exitCode:
+				t.Errorf("expected exit code %d, got %d: %v", tt.exitCode, exitCode(err), err)
+			}
+
+			if strings.Join(store.calls, ",") != strings.Join(tt.calls, ",") {
+				t.Errorf("expected calls %q, got %q", tt.calls, store.calls)
+			}
+			if tt.upload && !tt.tokenRefused && len(store.uploaded) == 0 {
+				t.Error("expected the package to be uploaded")
+			}
+		})
+	}
+}
+
+func TestExecPhaseTimeout(t *testing.T) {
+	source := newSource(t, "1.0.0")
+	defer os.RemoveAll(source)
+
+	p := Plugin{
+		ApplicationID: "app1",
+		Client:        blockingWebstore{},
+		Config: Config{
+			Source:        source,
+			Upload:        true,
+			UploadTimeout: 10 * time.Millisecond,
+		},
+	}
+
+	err := p.Exec(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "upload phase timed out") {
+		t.Fatalf("expected upload phase timeout, got %v", err)
+	}
+	if code := exitCode(err); code != ExitCodeError {
+		t.Errorf("expected exit code %d, got %d", ExitCodeError, code)
+	}
+}
+
+// blockingWebstore is a WebstoreAPI whose operations last until the context is done
+type blockingWebstore struct{}
+
+func (blockingWebstore) UploadNewVersion(ctx context.Context, pkg io.ReadSeeker) (UploadResult, error) {
+	<-ctx.Done()
+	return UploadResult{}, ctx.Err()
+}
+
+func (blockingWebstore) GetInfo(ctx context.Context, projection string) (Item, error) {
+	<-ctx.Done()
+	return Item{}, ctx.Err()
+}
+
+func (blockingWebstore) WaitForUpload(ctx context.Context, interval, timeout time.Duration) (Item, error) {
+	<-ctx.Done()
+	return Item{}, ctx.Err()
+}
+
+func (blockingWebstore) PublishVersion(ctx context.Context, target string, deployPercentage *int) (PublishResult, error) {
+	<-ctx.Done()
+	return PublishResult{}, ctx.Err()
+}
+
+func TestExecOutputIsPackage(t *testing.T) {
+	content := newZipContent(t)
+	dir, err := ioutil.TempDir("", "drone-chromewebstore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "extension.zip")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := fakeWebstore{uploadResult: UploadResult{ID: "app1", UploadState: UploadStateSuccess}}
+	p := Plugin{
+		ApplicationID: "app1",
+		Client:        &store,
+		Config: Config{
+			Package: path,
+			Output:  path,
+			Upload:  true,
+		},
+	}
+
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, content) {
+		t.Errorf("expected the package to be kept, got %d bytes instead of %d", len(written), len(content))
+	}
+	if !bytes.Equal(store.uploaded, content) {
+		t.Errorf("expected the package to be uploaded, got %d bytes instead of %d", len(store.uploaded), len(content))
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the package in the output directory, got %d files", len(files))
+	}
+}
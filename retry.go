@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy indicate how transient failures should be retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryTransport retry requests that fail with a network error, 429 or 5xx responses.
+// Non idempotent requests are retried only when the server has not accepted them.
+type RetryTransport struct {
+	Base   http.RoundTripper
+	Policy RetryPolicy
+	// Idempotent indicate that every request can be safely retried, whatever is its method
+	Idempotent bool
+}
+
+// RoundTrip execute the request, retrying it according to the retry policy
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := t.base().RoundTrip(req)
+
+		if attempt >= t.Policy.MaxAttempts || !t.shouldRetry(req, res, err) {
+			return res, err
+		}
+
+		next, ok := rewindBody(req)
+		if !ok {
+			return res, err
+		}
+
+		delay := t.delay(attempt, res)
+		fields := logrus.Fields{
+			"method":  req.Method,
+			"url":     req.URL.String(),
+			"attempt": attempt,
+			"delay":   delay,
+		}
+		if err != nil {
+			fields["error"] = err
+		} else {
+			fields["status"] = res.Status
+			res.Body.Close()
+		}
+		logrus.WithFields(fields).Warningln("request failed, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		req = next
+	}
+}
+
+func (t *RetryTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+
+	return http.DefaultTransport
+}
+
+func (t *RetryTransport) shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	idempotent := t.Idempotent || req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS"
+
+	if err != nil {
+		if idempotent {
+			return true
+		}
+
+		// The request never reached the server if the connection was not established
+		operr, ok := err.(*net.OpError)
+		return ok && operr.Op == "dial"
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// The server refused to process the request
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+
+	return false
+}
+
+// delay return the time to wait before the next attempt, honoring the Retry-After header
+func (t *RetryTransport) delay(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if after := retryAfter(res.Header.Get("Retry-After")); after > 0 {
+			return after
+		}
+	}
+
+	return t.Policy.backoff(attempt)
+}
+
+// backoff return the exponential delay to wait after the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.BaseDelay << uint(attempt-1)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		backoff = p.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	// Full jitter avoid clients retrying at the same time
+	return time.Duration(rand.Int63n(int64(backoff))) + 1
+}
+
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// rewindBody return a copy of the request with a fresh body so it can be sent again
+func rewindBody(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+
+	next := *req
+	next.Body = body
+
+	return &next, true
+}
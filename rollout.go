@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+var rolloutCommand = cli.Command{
+	Name:   "rollout",
+	Usage:  "Change the percentage of users receiving the published version",
+	Action: rollout,
+	Flags:  pluginFlags,
+}
+
+func rollout(c *cli.Context) error {
+	plugin := newPlugin(c)
+
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+	if plugin.Config.DeployPercentage == nil {
+		return cli.NewExitError("deploy percentage is required", ExitCodeError)
+	}
+
+	if err := validateDeployPercentage(*plugin.Config.DeployPercentage); err != nil {
+		return cli.NewExitError(err, ExitCodeError)
+	}
+
+	client, err := NewChromeWebstoreClient(ctx, plugin.ApplicationID, plugin.API, plugin.Authentication)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to create a chrome webstore client: %v", err), ExitCodeError)
+	}
+
+	effective, err := client.SetDeployPercentage(ctx, *plugin.Config.DeployPercentage)
+	if err != nil {
+		return cli.NewExitError(fmt.Errorf("unable to update deploy percentage: %v", err), exitCode(err))
+	}
+
+	if effective == nil {
+		fmt.Printf("Deploy of application %s to %d%% of users requested, the percentage applied is not reported by the store\n", plugin.ApplicationID, *plugin.Config.DeployPercentage)
+		return nil
+	}
+
+	fmt.Printf("Application %s is deployed to %d%% of users\n", plugin.ApplicationID, *effective)
+
+	return nil
+}
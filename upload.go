@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Upload modes supported by the client
+const (
+	// UploadModeResumable send the package in chunks, resuming from the committed offset after a failure
+	UploadModeResumable = "resumable"
+	// UploadModeSimple send the package in a single request
+	UploadModeSimple = "simple"
+)
+
+// DefaultUploadChunkSize is the size of the chunks sent by resumable uploads
+const DefaultUploadChunkSize = 8 << 20
+
+// uploadChunkGranularity is the size chunks should be a multiple of, except the last one
+const uploadChunkGranularity = 256 << 10
+
+// uploadProgressInterval is the minimum time between two logs of the upload progress
+const uploadProgressInterval = 5 * time.Second
+
+// sendPackage upload the package in a single request and return the response of the store
+func (client ChromeWebstoreClient) sendPackage(ctx context.Context, method, endpoint, contentType string, pkg io.ReadSeeker) (*http.Response, error) {
+	size, err := pkg.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get package size: %v", err)
+	}
+
+	req, err := client.newSectionRequest(ctx, method, endpoint, newProgressReader(pkg, size), 0, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create upload request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return client.Do(req)
+}
+
+// sendPackageResumable upload the package with the resumable upload protocol and return the response of the last chunk.
+// After a failure the offset committed by the store is queried, and the upload resume from it.
+// Each request is also retried by the RetryTransport of the client when the store refuse it (429 or 503),
+// so a chunk can be sent up to Retry.MaxAttempts² times.
+func (client ChromeWebstoreClient) sendPackageResumable(ctx context.Context, method, endpoint, contentType string, pkg io.ReadSeeker) (*http.Response, error) {
+	size, err := pkg.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get package size: %v", err)
+	}
+
+	session, err := client.startUploadSession(ctx, method, endpoint, contentType, size)
+	if err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			return nil, apiErr
+		}
+		return nil, fmt.Errorf("unable to start upload session: %v", err)
+	}
+
+	progress := newProgressReader(pkg, size)
+	var offset int64
+	query := false
+	for failures := 0; ; {
+		var res *http.Response
+		if query {
+			res, err = client.queryUploadOffset(ctx, session, size)
+		} else {
+			res, err = client.sendChunk(ctx, session, progress, offset, size)
+		}
+		if err == nil {
+			err = resumableError(res)
+		}
+
+		if err == nil {
+			if res.StatusCode != http.StatusPermanentRedirect {
+				// The upload is completed, or refused by the store
+				return res, nil
+			}
+
+			committed := committedOffset(res)
+			res.Body.Close()
+			progressed := committed > offset
+			offset = committed
+			if progressed {
+				failures = 0
+			}
+			if progressed || query {
+				// After a failure the upload resume from the queried offset, even when it did not move
+				query = false
+				continue
+			}
+
+			// A chunk without any byte committed is a failure, otherwise it would be sent forever
+			err = fmt.Errorf("no byte committed by the store, %d of %d bytes received", committed, size)
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		failures++
+		if failures >= client.Retry.MaxAttempts {
+			return nil, fmt.Errorf("upload interrupted after %d of %d bytes: %v", offset, size, err)
+		}
+
+		delay := client.Retry.backoff(failures)
+		logrus.WithFields(logrus.Fields{
+			"offset":  offset,
+			"total":   size,
+			"attempt": failures,
+			"delay":   delay,
+			"error":   err,
+		}).Warningln("upload interrupted, resuming")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		query = true
+	}
+}
+
+// startUploadSession initiate a resumable upload and return the URL of the session
+func (client ChromeWebstoreClient) startUploadSession(ctx context.Context, method, endpoint, contentType string, size int64) (string, error) {
+	req, err := client.newRequest(ctx, method, endpoint, url.Values{"uploadType": {"resumable"}}, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Upload-Content-Type", contentType)
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		// decodeResponse report non 2xx responses as APIError
+		return "", decodeResponse(res, nil)
+	}
+
+	session := res.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("no session returned by the store")
+	}
+
+	return session, nil
+}
+
+// sendChunk send the chunk of the package starting at offset
+func (client ChromeWebstoreClient) sendChunk(ctx context.Context, session string, pkg io.ReadSeeker, offset, size int64) (*http.Response, error) {
+	length := size - offset
+	if client.UploadChunkSize > 0 && length > client.UploadChunkSize {
+		length = client.UploadChunkSize
+	}
+
+	req, err := client.newSectionRequest(ctx, "PUT", session, pkg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+
+	return client.Do(req)
+}
+
+// queryUploadOffset ask the store how many bytes of the package have been committed
+func (client ChromeWebstoreClient) queryUploadOffset(ctx context.Context, session string, size int64) (*http.Response, error) {
+	req, err := client.newRequest(ctx, "PUT", session, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+	return client.Do(req)
+}
+
+// resumableError return an error, and close the response, when the status allow to resume the upload
+func resumableError(res *http.Response) error {
+	switch {
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		res.Body.Close()
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return nil
+}
+
+// committedOffset return the number of bytes received by the store, reported as "bytes=0-N" in the Range header
+func committedOffset(res *http.Response) int64 {
+	var last int64
+	if _, err := fmt.Sscanf(res.Header.Get("Range"), "bytes=0-%d", &last); err != nil {
+		return 0
+	}
+
+	return last + 1
+}
+
+// newSectionRequest build a request sending length bytes of the package from offset.
+// The body is read again from the package when the request is retried, so memory usage does not depend on the package size.
+func (client ChromeWebstoreClient) newSectionRequest(ctx context.Context, method, endpoint string, pkg io.ReadSeeker, offset, length int64) (*http.Request, error) {
+	getBody := func() (io.ReadCloser, error) {
+		if _, err := pkg.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		return ioutil.NopCloser(io.LimitReader(pkg, length)), nil
+	}
+
+	body, err := getBody()
+	if err != nil {
+		return nil, fmt.Errorf("unable to rewind package: %v", err)
+	}
+
+	req, err := client.newRequest(ctx, method, endpoint, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	req.GetBody = getBody
+
+	return req, nil
+}
+
+// progressReader log periodically the number of bytes read and the throughput
+type progressReader struct {
+	reader  io.ReadSeeker
+	total   int64
+	read    int64
+	started time.Time
+	logged  time.Time
+	done    bool
+}
+
+func newProgressReader(reader io.ReadSeeker, total int64) *progressReader {
+	now := time.Now()
+
+	return &progressReader{
+		reader:  reader,
+		total:   total,
+		started: now,
+		logged:  now,
+	}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	now := time.Now()
+	if err == io.EOF || r.read >= r.total {
+		if !r.done {
+			r.done = true
+			r.log(now, "upload sent")
+		}
+	} else if now.Sub(r.logged) >= uploadProgressInterval {
+		r.logged = now
+		r.log(now, "upload in progress")
+	}
+
+	return n, err
+}
+
+// Seek move the position in the package, counting the bytes before it as sent
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.reader.Seek(offset, whence)
+	if err == nil {
+		r.read = position
+	}
+
+	return position, err
+}
+
+func (r *progressReader) log(now time.Time, message string) {
+	fields := logrus.Fields{
+		"sent":  r.read,
+		"total": r.total,
+	}
+	if elapsed := now.Sub(r.started).Seconds(); elapsed > 0 {
+		fields["throughput"] = fmt.Sprintf("%.0f KiB/s", float64(r.read)/1024/elapsed)
+	}
+
+	logrus.WithFields(fields).Infoln(message)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendPackageResumableWithoutProgress(t *testing.T) {
+	var chunks int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("uploadType") == "resumable" {
+			w.Header().Set("Location", server.URL+"/session")
+			return
+		}
+
+		// Every chunk is acknowledged without any byte received
+		if !strings.HasPrefix(r.Header.Get("Content-Range"), "bytes */") {
+			atomic.AddInt32(&chunks, 1)
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}))
+	defer server.Close()
+
+	client := ChromeWebstoreClient{
+		Client:          server.Client(),
+		ApplicationID:   "app1",
+		APIVersion:      APIVersion1,
+		BaseURL:         server.URL,
+		UploadMode:      UploadModeResumable,
+		UploadChunkSize: uploadChunkGranularity,
+		Retry:           RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.sendPackageResumable(context.Background(), "PUT", server.URL+"/upload", "application/zip", bytes.NewReader(make([]byte, 1024)))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "upload interrupted after 0 of 1024 bytes") {
+			t.Fatalf("expected the upload to be interrupted, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload without progress never given up")
+	}
+
+	if n := atomic.LoadInt32(&chunks); n != 3 {
+		t.Errorf("expected the chunk to be sent 3 times, got %d", n)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var verifyCommand = cli.Command{
+	Name:   "verify",
+	Usage:  "Check credentials can access the application, without modifying it",
+	Action: verify,
+	Flags:  pluginFlags,
+}
+
+func verify(c *cli.Context) error {
+	plugin := newPlugin(c)
+
+	ctx, cancel := newContext(c.Duration("timeout"))
+	defer cancel()
+	plugin.Authentication.Scope = ChromeWebstoreReadOnlyScope
+
+	client, err := NewChromeWebstoreClient(ctx, plugin.ApplicationID, plugin.API, plugin.Authentication)
+	if err != nil {
+		return cli.NewExitError(describeTokenError(plugin.Authentication.Mode(), err), ExitCodeUnauthorized)
+	}
+
+	item, err := client.GetInfo(ctx, ProjectionDraft)
+	if err != nil {
+		if apiErr, ok := err.(APIError); ok {
+			switch apiErr.StatusCode {
+			case http.StatusNotFound:
+				return cli.NewExitError(fmt.Sprintf("application %s not found, check the application ID", plugin.ApplicationID), ExitCodeError)
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return cli.NewExitError(fmt.Sprintf("credentials are not allowed to manage application %s: %v", plugin.ApplicationID, apiErr), ExitCodeUnauthorized)
+			}
+		}
+		return cli.NewExitError(fmt.Errorf("unable to get application info: %v", err), ExitCodeError)
+	}
+
+	if item.UploadState == UploadStateNotFound {
+		return cli.NewExitError(fmt.Sprintf("application %s not found, check the application ID", plugin.ApplicationID), ExitCodeError)
+	}
+
+	fmt.Printf("Credentials are valid for application %s\n", plugin.ApplicationID)
+	fmt.Printf("Upload state: %s\n", item.UploadState)
+	fmt.Printf("Version: %s\n", item.CrxVersion)
+
+	return nil
+}
+
+// describeTokenError explain the most common reasons of token failures for the authentication mode
+func describeTokenError(mode string, err error) string {
+	message := err.Error()
+	invalidGrant := strings.Contains(message, "invalid_grant")
+
+	switch {
+	case mode == AuthModeRefreshToken && invalidGrant:
+		return fmt.Sprintf("refresh token has been revoked or is expired, generate a new one with the auth login command: %v", err)
+	case mode == AuthModeRefreshToken && (strings.Contains(message, "invalid_client") || strings.Contains(message, "unauthorized_client")):
+		return fmt.Sprintf("client ID or client secret are wrong: %v", err)
+	case mode == AuthModeServiceAccountKey && invalidGrant:
+		return fmt.Sprintf("service account key has been deleted or disabled, or the system clock is not synchronized: %v", err)
+	case mode == AuthModeOIDCToken && invalidGrant:
+		return fmt.Sprintf("OIDC token is expired or not accepted by the workload identity provider, check its audience and the provider attribute conditions: %v", err)
+	}
+
+	return fmt.Sprintf("unable to get an access token: %v", err)
+}
@@ -1,50 +1,188 @@
 package main
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hidez8891/encstr"
 	"github.com/hidez8891/zip"
+	"github.com/sirupsen/logrus"
 )
 
 type zipFile struct {
 	*zip.Writer
+	// filter select the paths added in the archive, nil add every path
+	filter *PathFilter
+	// modified is the modification time of every entry
+	modified time.Time
 }
 
+// DefaultModTime is the modification time of the entries when SOURCE_DATE_EPOCH is not set,
+// the oldest date supported by zip
+var DefaultModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	creatorUnix     = 3
+	unixRegularFile = 0100000
+)
+
 type archiveWriteFunc func(info os.FileInfo, file io.Reader, entryName string) (err error)
 
-// GenerateZipContent return zip content.
+// GenerateZipFile write the zip content in a temporary file, positioned at its beginning, and return its SHA-256.
+// The caller is responsible to close and remove the file once used.
+func GenerateZipFile(folderName string, filter *PathFilter) (*os.File, string, error) {
+	file, err := ioutil.TempFile("", "chromewebstore-")
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create temporary file: %v", err)
+	}
+
+	hash := sha256.New()
+	if err := WriteZipContent(io.MultiWriter(file, hash), folderName, filter); err != nil {
+		removeFile(file)
+		return nil, "", err
+	}
+
+	// Read the archive back, so a corrupted package is never uploaded
+	info, err := file.Stat()
+	if err != nil {
+		removeFile(file)
+		return nil, "", fmt.Errorf("unable to read zip file: %v", err)
+	}
+	if err := validatePackage(file, info.Size()); err != nil {
+		removeFile(file)
+		return nil, "", fmt.Errorf("invalid package generated from %s: %v", folderName, err)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		removeFile(file)
+		return nil, "", fmt.Errorf("unable to rewind zip file: %v", err)
+	}
+
+	return file, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteZipContent write the zip content of folderName in w.
+// The content is reproducible: entries are sorted by name, with the same permissions and the
+// modification time given by SOURCE_DATE_EPOCH (DefaultModTime when not set).
 // We should not use the standard zip package, see https://github.com/golang/go/issues/23301
-func GenerateZipContent(folderName string) (*bytes.Buffer, error) {
-	buf := new(bytes.Buffer)
+func WriteZipContent(w io.Writer, folderName string, filter *PathFilter) error {
+	modified, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	}
 
-	zip := zipFile{zip.NewWriter(buf)}
+	zip := zipFile{zip.NewWriter(w), filter, modified}
 
-	zip.AddAll(folderName, false)
+	if err := zip.AddAll(folderName, false); err != nil {
+		return err
+	}
 
 	if err := zip.Close(); err != nil {
-		return nil, fmt.Errorf("unable to generate zip content: %v", err)
+		return fmt.Errorf("unable to generate zip content: %v", err)
+	}
+
+	return nil
+}
+
+// sourceDateEpoch return the time set in SOURCE_DATE_EPOCH, see https://reproducible-builds.org/specs/source-date-epoch/
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return DefaultModTime, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", value, err)
+	}
+
+	modified := time.Unix(seconds, 0).UTC()
+	if modified.Before(DefaultModTime) {
+		modified = DefaultModTime
 	}
 
-	return buf, nil
+	return modified, nil
+}
+
+// header return the header of a file entry, without any attribute depending on the platform
+func (z *zipFile) header(entryName string) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:    encstr.NewString(entryName),
+		Method:  zip.Deflate,
+		Comment: encstr.NewString(""),
+		// Regular file readable by everyone, as created on unix
+		CreatorVersion: creatorUnix << 8,
+		ExternalAttrs:  (unixRegularFile | 0644) << 16,
+	}
+
+	// MS-DOS date and time, with a two seconds precision
+	t := z.modified
+	header.ModifiedDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	header.ModifiedTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+
+	return header
+}
+
+// validatePackage read every entry of the zip archive to check its CRC, and check manifest.json is at the root of the archive
+func validatePackage(r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("unable to read zip archive: %v", err)
+	}
+
+	manifest := false
+	for _, f := range archive.File {
+		name := f.Name.Str()
+		if name == "manifest.json" {
+			manifest = true
+		}
+
+		entry, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("unable to open entry %s: %v", name, err)
+		}
+		_, err = io.Copy(ioutil.Discard, entry)
+		entry.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read entry %s: %v", name, err)
+		}
+	}
+
+	if !manifest {
+		return fmt.Errorf("manifest.json not found at the root of the archive")
+	}
+
+	return nil
+}
+
+// removeFile close and delete a temporary file
+func removeFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
 }
 
 // AddAll adds all files from dir in archive, recursively.
 // Directories receive a zero-size entry in the archive, with a trailing slash in the header name, and no compression
 func (z *zipFile) AddAll(dir string, includeCurrentFolder bool) error {
 	dir = path.Clean(dir)
-	return addAll(dir, dir, includeCurrentFolder, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
+	return addAll(dir, dir, includeCurrentFolder, z.filter, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
 		// If we have a file to write (i.e., not a directory) then pipe the file into the archive writer
 		if file != nil {
-			writer, _ := z.Create(entryName, true)
+			writer, err := z.CreateHeader(z.header(entryName), true)
+			if err != nil {
+				return fmt.Errorf("unable to create entry %s: %v", entryName, err)
+			}
 			if _, err := io.Copy(writer, file); err != nil {
-				return err
+				return fmt.Errorf("unable to write entry %s: %v", entryName, err)
 			}
 		}
 
@@ -53,11 +191,11 @@ func (z *zipFile) AddAll(dir string, includeCurrentFolder bool) error {
 }
 
 // addAll is used to recursively go down through directories and add each file and directory to an archive, based on an archiveWriteFunc given to it
-func addAll(dir string, rootDir string, includeCurrentFolder bool, writerFunc archiveWriteFunc) error {
-	// Get a list of all entries in the directory, as []os.FileInfo
+func addAll(dir string, rootDir string, includeCurrentFolder bool, filter *PathFilter, writerFunc archiveWriteFunc) error {
+	// Get a list of all entries in the directory, sorted by name so the archive is reproducible, as []os.FileInfo
 	fileInfos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to read directory %s: %v", dir, err)
 	}
 
 	// Loop through all entries
@@ -65,13 +203,23 @@ func addAll(dir string, rootDir string, includeCurrentFolder bool, writerFunc ar
 
 		full := filepath.Join(dir, info.Name())
 
+		// Skipped directories are not walked
+		relative := path.Join(getSubDir(dir, rootDir, false), info.Name())
+		if skip, reason := filter.Skip(relative, info.IsDir()); skip {
+			logrus.WithFields(logrus.Fields{
+				"path":   relative,
+				"reason": reason,
+			}).Debugln("path skipped")
+			continue
+		}
+
 		// If the entry is a file, get an io.Reader for it
 		var file *os.File
 		var reader io.Reader
 		if !info.IsDir() {
 			file, err = os.Open(full)
 			if err != nil {
-				return err
+				return fmt.Errorf("unable to open file %s: %v", full, err)
 			}
 			reader = file
 		}
@@ -88,14 +236,16 @@ func addAll(dir string, rootDir string, includeCurrentFolder bool, writerFunc ar
 
 		if file != nil {
 			if err := file.Close(); err != nil {
-				return err
+				return fmt.Errorf("unable to close file %s: %v", full, err)
 			}
 
 		}
 
 		// If the entry is a directory, recurse into it
 		if info.IsDir() {
-			addAll(full, rootDir, includeCurrentFolder, writerFunc)
+			if err := addAll(full, rootDir, includeCurrentFolder, filter, writerFunc); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTree create a folder containing files, with the given permissions and modification time.
+// The caller is responsible to remove it.
+func newTree(t *testing.T, files map[string]string, perm os.FileMode, modified time.Time) string {
+	dir, err := ioutil.TempDir("", "drone-chromewebstore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), perm); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// setenv set an environment variable, and return a function restoring its previous value
+func setenv(t *testing.T, key, value string) func() {
+	previous, set := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if set {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestWriteZipContentReproducible(t *testing.T) {
+	defer setenv(t, "SOURCE_DATE_EPOCH", "")()
+
+	files := map[string]string{
+		"manifest.json":  `{"manifest_version": 3, "name": "test", "version": "1.0.0"}`,
+		"js/main.js":     "console.log('main')",
+		"js/lib/util.js": "console.log('util')",
+		"icon.png":       "png",
+	}
+
+	first := newTree(t, files, 0644, time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC))
+	defer os.RemoveAll(first)
+	second := newTree(t, files, 0755, time.Date(2024, time.July, 15, 18, 30, 0, 0, time.UTC))
+	defer os.RemoveAll(second)
+
+	var a, b bytes.Buffer
+	if err := WriteZipContent(&a, first, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := WriteZipContent(&b, second, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("expected the same archive for trees differing only by modification time and permissions")
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		modified time.Time
+		err      bool
+	}{
+		{
+			name:     "not set",
+			modified: DefaultModTime,
+		},
+		{
+			name:     "valid",
+			value:    "1700000000",
+			modified: time.Unix(1700000000, 0).UTC(),
+		},
+		{
+			name:  "invalid",
+			value: "yesterday",
+			err:   true,
+		},
+		{
+			name:     "before 1980",
+			value:    "0",
+			modified: DefaultModTime,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setenv(t, "SOURCE_DATE_EPOCH", tt.value)()
+
+			modified, err := sourceDateEpoch()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", modified)
+				}
+				if err := WriteZipContent(ioutil.Discard, ".", nil); err == nil {
+					t.Error("expected the packaging to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !modified.Equal(tt.modified) {
+				t.Errorf("expected %s, got %s", tt.modified, modified)
+			}
+		})
+	}
+}
+
+// newStoredZip return a zip archive with uncompressed entries
+func newStoredZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestValidatePackage(t *testing.T) {
+	manifest := `{"manifest_version": 3, "name": "test", "version": "1.0.0"}`
+
+	corrupted := newStoredZip(t, map[string]string{"manifest.json": manifest})
+	// The content of the entry is stored as is, after the local header
+	offset := bytes.Index(corrupted, []byte(manifest))
+	corrupted[offset] = '['
+
+	tests := []struct {
+		name    string
+		archive []byte
+		err     string
+	}{
+		{
+			name:    "valid",
+			archive: newStoredZip(t, map[string]string{"manifest.json": manifest, "js/main.js": "main"}),
+		},
+		{
+			name:    "manifest not at the root",
+			archive: newStoredZip(t, map[string]string{"extension/manifest.json": manifest}),
+			err:     "manifest.json not found at the root of the archive",
+		},
+		{
+			name:    "corrupted CRC",
+			archive: corrupted,
+			err:     "unable to read entry manifest.json",
+		},
+		{
+			name:    "not a zip",
+			archive: []byte(manifest),
+			err:     "unable to read zip archive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePackage(bytes.NewReader(tt.archive), int64(len(tt.archive)))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestGenerateZipFileUnreadableDirectory(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	dir := newTree(t, map[string]string{
+		"manifest.json":  `{"manifest_version": 3, "name": "test", "version": "1.0.0"}`,
+		"private/key.js": "secret",
+	}, 0644, DefaultModTime)
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(private, 0755)
+
+	file, _, err := GenerateZipFile(dir, nil)
+	if err == nil {
+		removeFile(file)
+		t.Fatal("expected an error for an unreadable directory")
+	}
+	if !strings.Contains(err.Error(), private) {
+		t.Errorf("expected the error to name %s, got %v", private, err)
+	}
+}